@@ -15,7 +15,6 @@ import (
 	"path/filepath"
 	"sort"
 	"strconv"
-	"strings"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -40,8 +39,12 @@ var (
 	noiseColor           string
 	shiftChannel         bool
 	colorBoost           string
+	colorBoostStrength   float64
+	colorBoostBlend      string
 	splitWidth           int
 	splitLength          int
+	verticalSplitWidth   int
+	verticalSplitLength  int
 	seed                 int64
 	makegif              bool
 	gifDelay             int
@@ -49,7 +52,9 @@ var (
 	overlayImage         string
 	overlayEveryNthFrame int
 	gui                  bool
+	recipe               *soryu.Graph
 	currentImg           *soryu.Img
+	previousSteps        soryu.StepHistory
 )
 
 func NewImage(file string) (*soryu.Img, error) {
@@ -95,77 +100,32 @@ func CreateGlitchedImage(fileName string, reseed bool, imgNumber int) *soryu.Img
 		log.Fatal(err)
 	}
 	i.Copy()
-	commands := strings.Split(effects, ",")
-	for _, effect := range commands {
-		fmt.Println("Applying ", effect)
-		switch effect {
-		case "Streak":
-			if imgNumber%2 == 0 {
-				streakAmount += (rand.Intn(100) / 5) + 5
-			}
-			i.Streak(streakAmount, streakWidth, streakDirection)
-		case "Burst":
-			if imgNumber%2 == 0 {
-				continue
-			}
-			i.Burst()
-		case "ShiftChannel":
-			i.ShiftChannel(shiftChannel)
-		case "Ghost":
-			i.Ghost()
-		case "GhostStretch":
-			i.GhostStretch()
-		case "ColorBoost":
-			i.ColorBoost(colorBoost)
-		case "Split":
-			if imgNumber%5 == 0 {
-				continue
-			}
-			newWidth := splitWidth
-			if imgNumber == 1 || imgNumber == 3 {
-				newWidth = splitWidth + rand.Intn(10)
-			}
-			i.Split(newWidth, splitLength, false)
-		case "VerticalSplit":
-			if imgNumber%5 == 0 {
-				continue
-			}
-			newWidth := splitWidth
-			if imgNumber == 1 || imgNumber == 3 {
-				newWidth = splitWidth + rand.Intn(10)
-			}
-			i.VerticalSplit(newWidth, splitLength, false)
-		case "Noise":
-			i.Noise(noiseColor)
-		case "GaussianNoise":
-			i.GaussianNoise()
-		case "Scanlines":
-			i.Scanlines()
-		case "BigLines":
-			if imgNumber%5 == 0 {
-				continue
-			}
-			i.BigLines()
-		case "CopyChannelBigLines":
-			i.CopyChannelBigLines()
-		case "RandomCorruptions":
-			if makegif {
-				if imgNumber%6 == 0 {
-					i.RandomCorruptions(false)
-				}
-			} else {
-				i.RandomCorruptions(false)
-			}
-		case "OverlayImage":
-			if makegif {
-				if imgNumber%overlayEveryNthFrame == 0 {
-					i.OverlayImage(overlayImage)
-				}
-			} else {
-				i.OverlayImage(overlayImage)
-			}
+	if makegif {
+		i.Frame = imgNumber
+	}
+	if recipe != nil {
+		fmt.Println("Running recipe")
+		i, err = recipe.Run(i, rand.Int63())
+		if err != nil {
+			log.Fatal(err)
 		}
 	}
+	var steps soryu.StepHistory
+	for _, step := range soryu.ParseSteps(effects) {
+		fmt.Println("Applying ", step.Effect)
+		apply := func() {
+			applyEffect(i, step, imgNumber)
+		}
+		if makegif {
+			err = i.ApplyFrameStep(step, &previousSteps, &steps, apply)
+		} else {
+			err = i.ApplyStep(step, apply)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	previousSteps = steps
 	newFile := fileName
 	f, err := os.Create(newFile)
 	if err != nil {
@@ -176,6 +136,121 @@ func CreateGlitchedImage(fileName string, reseed bool, imgNumber int) *soryu.Img
 	return i
 }
 
+func applyEffect(i *soryu.Img, step soryu.Step, imgNumber int) {
+	switch step.Effect {
+	case "Streak":
+		if imgNumber%2 == 0 {
+			streakAmount += (rand.Intn(100) / 5) + 5
+		}
+		if err := runEffect(i, withFlagDefaults(step, map[string]string{
+			"amount": strconv.Itoa(streakAmount),
+			"width":  strconv.Itoa(streakWidth),
+			"left":   strconv.FormatBool(streakDirection),
+		})); err != nil {
+			log.Fatal(err)
+		}
+	case "Burst":
+		if imgNumber%2 == 0 {
+			return
+		}
+		i.Burst()
+	case "ShiftChannel":
+		i.ShiftChannel(shiftChannel)
+	case "Ghost":
+		i.Ghost()
+	case "GhostStretch":
+		i.GhostStretch()
+	case "ColorBoost":
+		if err := runEffect(i, colorBoostStep(step)); err != nil {
+			log.Fatal(err)
+		}
+	case "Split":
+		if imgNumber%5 == 0 {
+			return
+		}
+		newWidth := splitWidth
+		if imgNumber == 1 || imgNumber == 3 {
+			newWidth = splitWidth + rand.Intn(10)
+		}
+		i.Split(newWidth, splitLength, false)
+	case "VerticalSplit":
+		if imgNumber%5 == 0 {
+			return
+		}
+		newWidth := verticalSplitWidth
+		if imgNumber == 1 || imgNumber == 3 {
+			newWidth = verticalSplitWidth + rand.Intn(10)
+		}
+		i.VerticalSplit(newWidth, verticalSplitLength, false)
+	case "Noise":
+		i.Noise(noiseColor)
+	case "GaussianNoise":
+		i.GaussianNoise()
+	case "Scanlines":
+		i.Scanlines()
+	case "BigLines":
+		if imgNumber%5 == 0 {
+			return
+		}
+		i.BigLines()
+	case "CopyChannelBigLines":
+		i.CopyChannelBigLines()
+	case "RandomCorruptions":
+		if makegif {
+			if imgNumber%6 == 0 {
+				i.RandomCorruptions(false)
+			}
+		} else {
+			i.RandomCorruptions(false)
+		}
+	case "OverlayImage":
+		if makegif {
+			if imgNumber%overlayEveryNthFrame == 0 {
+				i.OverlayImage(overlayImage)
+			}
+		} else {
+			i.OverlayImage(overlayImage)
+		}
+	default:
+		if err := runEffect(i, step); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// runEffect runs a step with the effect registered under its name.
+func runEffect(i *soryu.Img, step soryu.Step) error {
+	effect, ok := soryu.Effects[step.Effect]
+	if !ok {
+		return fmt.Errorf("unknown effect %s", step.Effect)
+	}
+	return effect(i, step)
+}
+
+// colorBoostStep takes the ColorBoost parameters the step doesn't set from
+// the --color-boost flags.
+func colorBoostStep(step soryu.Step) soryu.Step {
+	return withFlagDefaults(step, map[string]string{
+		"color":    colorBoost,
+		"strength": strconv.FormatFloat(colorBoostStrength, 'f', -1, 64),
+		"mode":     colorBoostBlend,
+	})
+}
+
+// withFlagDefaults fills in the parameters the step doesn't set, so the flags
+// act as defaults for the parameters written in --order.
+func withFlagDefaults(step soryu.Step, defaults map[string]string) soryu.Step {
+	params := make(map[string]string, len(defaults)+len(step.Params))
+	for k, v := range defaults {
+		params[k] = v
+	}
+	for k, v := range step.Params {
+		params[k] = v
+	}
+	step.Params = params
+	return step
+}
+
 func Run() {
 	if !makegif {
 		rand.Seed(seed)
@@ -419,13 +494,15 @@ func handleGuiEffects(i *soryu.Img) *soryu.Img {
 		case "GhostStretch":
 			i.GhostStretch()
 		case "ColorBoost":
-			i.ColorBoost(colorBoost)
+			if err := runEffect(i, colorBoostStep(soryu.Step{Effect: effect})); err != nil {
+				log.Println(err)
+			}
 		case "Split":
 			newWidth := splitWidth
 			i.Split(newWidth, splitLength, false)
 		case "VerticalSplit":
-			newWidth := splitWidth
-			i.VerticalSplit(newWidth, splitLength, false)
+			newWidth := verticalSplitWidth
+			i.VerticalSplit(newWidth, verticalSplitLength, false)
 		case "Noise":
 			i.Noise(noiseColor)
 		case "GaussianNoise":
@@ -442,6 +519,10 @@ func handleGuiEffects(i *soryu.Img) *soryu.Img {
 			i.Burst()
 		case "OverlayImage":
 			i.OverlayImage(overlayImage)
+		default:
+			if err := i.Apply(soryu.ParseStep(effect)); err != nil {
+				log.Println(err)
+			}
 		}
 	}
 
@@ -493,7 +574,7 @@ func main() {
 		&cli.BoolFlag{
 			Name:    "streak-direction",
 			Aliases: []string{"sd"},
-			Usage:   "the direction of the streak, true for left [broken]",
+			Usage:   "the direction of the streak, true for left",
 			Value:   true,
 		},
 		// Noise - #FFFFFF
@@ -514,9 +595,21 @@ func main() {
 		&cli.StringFlag{
 			Name:    "color-boost",
 			Aliases: []string{"cb"},
-			Usage:   "the color to boost [red, green, blue]",
+			Usage:   "the color to boost, red, green, blue or a hex color",
 			Value:   "red",
 		},
+		&cli.Float64Flag{
+			Name:    "color-boost-strength",
+			Aliases: []string{"cbs"},
+			Usage:   "how strong the color is boosted, from 0 to 1",
+			Value:   0.3,
+		},
+		&cli.StringFlag{
+			Name:    "color-boost-blend",
+			Aliases: []string{"cbb"},
+			Usage:   "how the color is blended [tint, multiply, screen, overlay]",
+			Value:   "tint",
+		},
 		// Split - width, length int, true
 		&cli.IntFlag{
 			Name:    "split-width",
@@ -573,6 +666,12 @@ func main() {
 			Usage:   "overlay every nth frame in a gif",
 			Value:   3,
 		},
+		&cli.StringFlag{
+			Name:    "recipe",
+			Aliases: []string{"r"},
+			Usage:   "a json recipe describing a graph of effects, --order is applied after it if given",
+			Value:   "",
+		},
 		&cli.BoolFlag{
 			Name:  "gui",
 			Usage: "run soryu with a gui",
@@ -591,14 +690,28 @@ func main() {
 		noiseColor = c.String("noise-color")
 		shiftChannel = c.Bool("shift-channel-direction")
 		colorBoost = c.String("color-boost")
+		colorBoostStrength = c.Float64("color-boost-strength")
+		colorBoostBlend = c.String("color-boost-blend")
 		splitWidth = c.Int("split-width")
 		splitLength = c.Int("split-length")
+		verticalSplitWidth = c.Int("vertical-split-width")
+		verticalSplitLength = c.Int("vertical-split-length")
 		makegif = c.Bool("gif")
 		gifDelay = c.Int("gif-delay")
 		gifFrames = c.Int("gif-frames")
 		overlayImage = c.String("overlay-image")
 		overlayEveryNthFrame = c.Int("overlay-every-nth-frame")
 		gui = c.Bool("gui")
+		if path := c.String("recipe"); path != "" {
+			g, err := soryu.LoadGraph(path)
+			if err != nil {
+				log.Fatal(err)
+			}
+			recipe = g
+			if !c.IsSet("order") {
+				effects = ""
+			}
+		}
 		if inputFile == "" && !gui {
 			log.Fatal("Please enter a file")
 		}
@@ -0,0 +1,87 @@
+package soryu
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// ChromaticAberrationOptions configures ChromaticAberration.
+type ChromaticAberrationOptions struct {
+	// Offsets moves the red, green and blue channel by the given pixels
+	Offsets [3]image.Point
+	// Radial moves the channels away from the center instead, by Amounts pixels
+	// at the corners and less towards the center. Negative amounts move a
+	// channel inwards.
+	Radial  bool
+	Amounts [3]float64
+	// Center of the radial mode relative to the image size
+	CenterX, CenterY float64
+	// Edge decides what is sampled outside the image: "clamp" repeats the
+	// border, "wrap" the other side and "transparent" nothing
+	Edge string
+}
+
+// ChromaticAberration splits the image into its red, green and blue channel
+// and displaces them separately, like a cheap lens.
+func (i *Img) ChromaticAberration(o ChromaticAberrationOptions) error {
+	switch o.Edge {
+	case "clamp", "wrap", "transparent":
+	default:
+		return fmt.Errorf("unknown edge mode %q", o.Edge)
+	}
+
+	src := cloneImage(i.Out)
+	b := i.Bounds
+	cx := float64(b.Min.X) + o.CenterX*float64(b.Dx())
+	cy := float64(b.Min.Y) + o.CenterY*float64(b.Dy())
+	// distance from the center to the farthest corner
+	var radius float64
+	for _, p := range []image.Point{b.Min, {b.Max.X, b.Min.Y}, {b.Min.X, b.Max.Y}, b.Max} {
+		radius = math.Max(radius, math.Hypot(float64(p.X)-cx, float64(p.Y)-cy))
+	}
+
+	sample := func(x, y int) (color.RGBA, bool) {
+		p := image.Pt(x, y)
+		if !p.In(b) {
+			switch o.Edge {
+			case "transparent":
+				return color.RGBA{}, false
+			case "wrap":
+				p = image.Pt(
+					b.Min.X+((x-b.Min.X)%b.Dx()+b.Dx())%b.Dx(),
+					b.Min.Y+((y-b.Min.Y)%b.Dy()+b.Dy())%b.Dy(),
+				)
+			default:
+				p = image.Pt(maxInt(b.Min.X, minInt(x, b.Max.X-1)), maxInt(b.Min.Y, minInt(y, b.Max.Y-1)))
+			}
+		}
+		return src.RGBAAt(p.X, p.Y), true
+	}
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var channels [3]uint8
+			var alpha uint8
+			for ch := range channels {
+				d := o.Offsets[ch]
+				if o.Radial {
+					dx, dy := float64(x)-cx, float64(y)-cy
+					scale := o.Amounts[ch] / radius
+					d = image.Pt(int(math.Round(dx*scale)), int(math.Round(dy*scale)))
+				}
+				c, ok := sample(x-d.X, y-d.Y)
+				if !ok {
+					continue
+				}
+				channels[ch] = [3]uint8{c.R, c.G, c.B}[ch]
+				if c.A > alpha {
+					alpha = c.A
+				}
+			}
+			i.Out.Set(x, y, color.RGBA{channels[0], channels[1], channels[2], alpha})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package soryu
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// BandShiftOptions configures BandShift.
+type BandShiftOptions struct {
+	// Angle of the bands in degrees, 0 cuts horizontal bands that are moved
+	// sideways, 90 vertical bands moved up and down
+	Angle float64
+	// Width of every band across the angle
+	Width IntRange
+	// Offset of every band along the angle
+	Offset IntRange
+	// Alternate leaves every other band alone, starting with the first
+	Alternate bool
+	// Edge decides what is sampled outside the image: "wrap", "clamp" or
+	// "transparent"
+	Edge string
+	// FromIn moves bands of the original image instead of the glitched one
+	FromIn bool
+}
+
+// BandShift cuts the image into parallel bands and moves each of them along
+// its length by a random offset.
+func (i *Img) BandShift(o BandShiftOptions) error {
+	switch o.Edge {
+	case "wrap", "clamp", "transparent":
+	default:
+		return fmt.Errorf("unknown edge mode %q", o.Edge)
+	}
+
+	b := i.Bounds
+	if b.Empty() {
+		return nil
+	}
+	var src *image.RGBA
+	if o.FromIn {
+		src = image.NewRGBA(b)
+		draw.Draw(src, b, i.In, b.Min, draw.Src)
+	} else {
+		src = cloneImage(i.Out)
+	}
+
+	rad := o.Angle * math.Pi / 180
+	dx, dy := math.Cos(rad), math.Sin(rad)
+	// keep right angles exact, cos(90°) is not quite 0 in floating point
+	dx, dy = math.Round(dx*1e9)/1e9, math.Round(dy*1e9)/1e9
+	// position of a pixel across the bands, starting at 0
+	across := func(x, y int) int {
+		return int(math.Floor(-float64(x-b.Min.X)*dy + float64(y-b.Min.Y)*dx))
+	}
+	lo, hi := math.MaxInt32, math.MinInt32
+	for _, p := range []image.Point{b.Min, {b.Max.X - 1, b.Min.Y}, {b.Min.X, b.Max.Y - 1}, b.Max.Sub(image.Pt(1, 1))} {
+		lo = minInt(lo, across(p.X, p.Y))
+		hi = maxInt(hi, across(p.X, p.Y))
+	}
+
+	// offset of the band at every position across, nil for bands left alone
+	offsets := make([]*image.Point, hi-lo+1)
+	shift := !o.Alternate
+	for pos := 0; pos < len(offsets); {
+		width := maxInt(o.Width.Rand(), 1)
+		if shift {
+			n := float64(o.Offset.Rand())
+			d := image.Pt(int(math.Round(dx*n)), int(math.Round(dy*n)))
+			for k := pos; k < minInt(pos+width, len(offsets)); k++ {
+				offsets[k] = &d
+			}
+		}
+		pos += width
+		if o.Alternate {
+			shift = !shift
+		}
+	}
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			d := offsets[across(x, y)-lo]
+			if d == nil {
+				continue
+			}
+			sx, sy := x+d.X, y+d.Y
+			switch o.Edge {
+			case "wrap":
+				sx = b.Min.X + ((sx-b.Min.X)%b.Dx()+b.Dx())%b.Dx()
+				sy = b.Min.Y + ((sy-b.Min.Y)%b.Dy()+b.Dy())%b.Dy()
+			case "clamp":
+				sx, sy = clampX(b, sx), clampY(b, sy)
+			case "transparent":
+				if !image.Pt(sx, sy).In(b) {
+					i.Out.Set(x, y, color.Transparent)
+					continue
+				}
+			}
+			i.Out.Set(x, y, src.RGBAAt(sx, sy))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package soryu
+
+import (
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/anthonynsimon/bild/blend"
+	"github.com/anthonynsimon/bild/fcolor"
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+var blendModes = map[string]func(bg, fg image.Image) *image.RGBA{
+	"normal":      blend.Normal,
+	"add":         blend.Add,
+	"subtract":    blend.Subtract,
+	"multiply":    blend.Multiply,
+	"divide":      blend.Divide,
+	"screen":      blend.Screen,
+	"overlay":     blend.Overlay,
+	"softlight":   blend.SoftLight,
+	"difference":  blend.Difference,
+	"exclusion":   blend.Exclusion,
+	"darken":      blend.Darken,
+	"lighten":     blend.Lighten,
+	"colordodge":  blend.ColorDodge,
+	"colorburn":   blend.ColorBurn,
+	"lineardodge": blend.Add,
+	"linearburn":  blend.LinearBurn,
+	"linearlight": blend.LinearLight,
+	"hue": hclBlend(func(b, f [3]float64) [3]float64 {
+		return [3]float64{f[0], b[1], b[2]}
+	}),
+	"saturation": hclBlend(func(b, f [3]float64) [3]float64 {
+		return [3]float64{b[0], f[1], b[2]}
+	}),
+	"color": hclBlend(func(b, f [3]float64) [3]float64 {
+		return [3]float64{f[0], f[1], b[2]}
+	}),
+	"luminosity": hclBlend(func(b, f [3]float64) [3]float64 {
+		return [3]float64{b[0], b[1], f[2]}
+	}),
+}
+
+// Composite blends fg over bg with the given blend mode, then mixes the result
+// with bg by opacity (0-1). Mode names are case insensitive and may contain
+// spaces, dashes or underscores, e.g. "color-dodge".
+func Composite(bg, fg image.Image, mode string, opacity float64) (*image.RGBA, error) {
+	fn, ok := blendModes[normalizeBlendMode(mode)]
+	if !ok {
+		return nil, fmt.Errorf("unknown blend mode %q", mode)
+	}
+	result := fn(bg, fg)
+	if opacity >= 1 {
+		return result, nil
+	}
+	return blend.Opacity(bg, result, opacity), nil
+}
+
+func normalizeBlendMode(mode string) string {
+	return strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(mode))
+}
+
+// hclBlend builds a non separable blend mode that mixes the hue, chroma and
+// luminance components (in that order) of both layers.
+func hclBlend(mix func(bg, fg [3]float64) [3]float64) func(bg, fg image.Image) *image.RGBA {
+	return func(bg, fg image.Image) *image.RGBA {
+		return blend.Blend(bg, fg, func(c0, c1 fcolor.RGBAF64) fcolor.RGBAF64 {
+			bh, bc, bl := colorful.Color{R: c0.R, G: c0.G, B: c0.B}.Hcl()
+			fh, fc, fl := colorful.Color{R: c1.R, G: c1.G, B: c1.B}.Hcl()
+			m := mix([3]float64{bh, bc, bl}, [3]float64{fh, fc, fl})
+			c := colorful.Hcl(m[0], m[1], m[2]).Clamped()
+
+			a := c1.A
+			return fcolor.RGBAF64{
+				R: c.R*a + c0.R*(1-a),
+				G: c.G*a + c0.G*(1-a),
+				B: c.B*a + c0.B*(1-a),
+				A: c0.A + a,
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package soryu
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// Luma, ChromaBlue and ChromaRed address the planes of an image that is split
+// in YCbCr instead of RGB.
+const (
+	Luma       = Red
+	ChromaBlue = Green
+	ChromaRed  = Blue
+)
+
+func init() {
+	// registered here as it applies other effects from the table itself
+	Effects["ChannelSplit"] = func(i *Img, s Step) error {
+		ycbcr := s.String("space", "rgb") == "ycbcr"
+		names := map[string]Channel{"red": Red, "green": Green, "blue": Blue, "alpha": Alpha}
+		if ycbcr {
+			names = map[string]Channel{"y": Luma, "cb": ChromaBlue, "cr": ChromaRed}
+		}
+
+		// a chain is written as "Split;width=8+Streak", effects joined by
+		// "+" with their parameters separated by ";"
+		chains := map[Channel][]Step{}
+		for name, channel := range names {
+			for _, effect := range strings.Split(s.String(name, ""), "+") {
+				if effect != "" {
+					chains[channel] = append(chains[channel], ParseStep(strings.ReplaceAll(effect, ";", ":")))
+				}
+			}
+		}
+		return i.ChannelSplit(chains, ycbcr)
+	}
+}
+
+// ChannelSplit runs a separate chain of steps on a grayscale view of each
+// channel and merges the glitched channels back into the image. With ycbcr
+// the channels are Luma, ChromaBlue and ChromaRed instead of red, green and
+// blue. Channels without a chain are left untouched. The chains run in
+// channel order, so a seed always gives the same image.
+func (i *Img) ChannelSplit(chains map[Channel][]Step, ycbcr bool) error {
+	planes := splitChannels(i.Out, i.Bounds, ycbcr)
+	var previous, previousResult [4][]uint8
+	if i.Previous != nil {
+		previous = splitChannels(i.Previous, i.Bounds, ycbcr)
+	}
+	if i.PreviousResult != nil {
+		previousResult = splitChannels(i.PreviousResult, i.Bounds, ycbcr)
+	}
+
+	for channel := Red; channel <= Alpha; channel++ {
+		steps, ok := chains[channel]
+		if !ok {
+			continue
+		}
+		if ycbcr && channel == Alpha {
+			return fmt.Errorf("alpha can't be split in ycbcr")
+		}
+		view := planeImage(planes[channel], i.Bounds)
+		sub := &Img{
+			In:      view,
+			Out:     cloneImage(view),
+			Bounds:  i.Bounds,
+			Imgtype: i.Imgtype,
+			Frame:   i.Frame,
+		}
+		// the same channel of the last gif frame, the result is that of the
+		// whole chain
+		if i.Previous != nil {
+			sub.Previous = planeImage(previous[channel], i.Bounds)
+		}
+		if i.PreviousResult != nil {
+			sub.PreviousResult = planeImage(previousResult[channel], i.Bounds)
+		}
+		for _, s := range steps {
+			if err := sub.Apply(s); err != nil {
+				return err
+			}
+		}
+
+		b := i.Bounds
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				g := color.GrayModel.Convert(sub.Out.At(x, y)).(color.Gray)
+				planes[channel][(y-b.Min.Y)*b.Dx()+(x-b.Min.X)] = g.Y
+			}
+		}
+	}
+
+	i.mergeChannels(planes, ycbcr)
+	return nil
+}
+
+// splitChannels returns the 8 bit planes of img within b, indexed by Channel.
+func splitChannels(img image.Image, b image.Rectangle, ycbcr bool) [4][]uint8 {
+	var planes [4][]uint8
+	for n := range planes {
+		planes[n] = make([]uint8, b.Dx()*b.Dy())
+	}
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			n := (y-b.Min.Y)*b.Dx() + (x - b.Min.X)
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if ycbcr {
+				planes[Luma][n], planes[ChromaBlue][n], planes[ChromaRed][n] = color.RGBToYCbCr(c.R, c.G, c.B)
+			} else {
+				planes[Red][n], planes[Green][n], planes[Blue][n] = c.R, c.G, c.B
+			}
+			planes[Alpha][n] = c.A
+		}
+	}
+	return planes
+}
+
+// mergeChannels writes the planes back into Out.
+func (i *Img) mergeChannels(planes [4][]uint8, ycbcr bool) {
+	b := i.Bounds
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			n := (y-b.Min.Y)*b.Dx() + (x - b.Min.X)
+			c := color.NRGBA{planes[Red][n], planes[Green][n], planes[Blue][n], planes[Alpha][n]}
+			if ycbcr {
+				c.R, c.G, c.B = color.YCbCrToRGB(planes[Luma][n], planes[ChromaBlue][n], planes[ChromaRed][n])
+			}
+			i.Out.Set(x, y, c)
+		}
+	}
+}
+
+// planeImage shows a single channel as an opaque grayscale RGBA image, so
+// every effect can work on it.
+func planeImage(plane []uint8, bounds image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(bounds)
+	for n, v := range plane {
+		img.Pix[n*4+0] = v
+		img.Pix[n*4+1] = v
+		img.Pix[n*4+2] = v
+		img.Pix[n*4+3] = 0xff
+	}
+	return img
+}
@@ -0,0 +1,157 @@
+package soryu
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// CRTOptions configures CRT. Sizes are given in pixels of a 480 line screen
+// and scaled to the height of the image.
+type CRTOptions struct {
+	// Curvature bends the image like the glass of a tube, 0 is flat
+	Curvature float64
+	// ScanlineSpacing is the distance between scanlines, ScanlineThickness
+	// the share of it that is dark (0-1) and ScanlineDarkness how dark (0-1)
+	ScanlineSpacing   float64
+	ScanlineThickness float64
+	ScanlineDarkness  float64
+	// Mask is the phosphor pattern: "grille" for vertical stripes, "shadow"
+	// for staggered triads or "none". MaskStrength is how visible it is (0-1)
+	Mask         string
+	MaskStrength float64
+	// Bloom is how much bright areas glow
+	Bloom float64
+	// Vignette darkens the corners (0-1)
+	Vignette float64
+	// Misconvergence moves the red and blue beams apart
+	Misconvergence float64
+}
+
+// CRT emulates an image shown on a tube screen.
+func (i *Img) CRT(o CRTOptions) error {
+	switch o.Mask {
+	case "grille", "shadow", "none":
+	default:
+		return fmt.Errorf("unknown crt mask %q", o.Mask)
+	}
+
+	b := i.Bounds
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return nil
+	}
+	scale := float64(h) / 480
+	src := cloneImage(i.Out)
+
+	if o.Bloom > 0 {
+		addBloom(src.Pix, w, h, o.Bloom, maxInt(1, int(6*scale)))
+	}
+
+	spacing := math.Max(o.ScanlineSpacing*scale, 1)
+	// width of one phosphor stripe in pixels
+	stripe := maxInt(1, int(math.Round(scale)))
+	shift := o.Misconvergence * scale
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// position on the screen from -1 to 1
+			u := float64(x)/float64(w-1)*2 - 1
+			v := float64(y)/float64(h-1)*2 - 1
+			if w == 1 {
+				u = 0
+			}
+			if h == 1 {
+				v = 0
+			}
+			r2 := u*u + v*v
+			su, sv := u*(1+o.Curvature*r2), v*(1+o.Curvature*r2)
+			if math.Abs(su) > 1 || math.Abs(sv) > 1 {
+				i.Out.Set(b.Min.X+x, b.Min.Y+y, color.RGBA{0, 0, 0, 0xff})
+				continue
+			}
+			sx := float64(b.Min.X) + (su+1)/2*float64(w-1)
+			sy := float64(b.Min.Y) + (sv+1)/2*float64(h-1)
+
+			c := bilinear(src, sx, sy)
+			red := float64(bilinear(src, sx-shift, sy).R)
+			green := float64(c.G)
+			blue := float64(bilinear(src, sx+shift, sy).B)
+
+			// scanlines follow the curved screen
+			factor := 1.0
+			if math.Mod(sy-float64(b.Min.Y), spacing)/spacing < o.ScanlineThickness {
+				factor -= o.ScanlineDarkness
+			}
+			factor *= clamp01(1 - o.Vignette*r2/2)
+
+			if o.Mask != "none" {
+				column := x / stripe
+				if o.Mask == "shadow" && (y/(2*stripe))%2 == 1 {
+					// every other row of triads is offset by half a triad
+					column += 1
+				}
+				dim := 1 - o.MaskStrength
+				mask := [3]float64{dim, dim, dim}
+				mask[column%3] = 1
+				if o.Mask == "shadow" && y%(2*stripe) == 0 {
+					// dark gap between the rows of dots
+					mask = [3]float64{dim, dim, dim}
+				}
+				red *= mask[0]
+				green *= mask[1]
+				blue *= mask[2]
+			}
+
+			// the beams are sampled apart, keep them premultiplied
+			a := float64(c.A) / 255
+			i.Out.Set(b.Min.X+x, b.Min.Y+y, color.RGBA{
+				gray(math.Min(red*factor/255, a)),
+				gray(math.Min(green*factor/255, a)),
+				gray(math.Min(blue*factor/255, a)),
+				c.A,
+			})
+		}
+	}
+	return nil
+}
+
+// addBloom adds a blurred copy of the bright parts of an RGBA buffer to it.
+func addBloom(pix []uint8, w, h int, strength float64, radius int) {
+	var glow [3][]float64
+	for ch := range glow {
+		glow[ch] = make([]float64, w*h)
+	}
+	for n := 0; n < w*h; n++ {
+		r, g, b := float64(pix[n*4])/255, float64(pix[n*4+1])/255, float64(pix[n*4+2])/255
+		bright := math.Max(0, 0.299*r+0.587*g+0.114*b-0.6) / 0.4
+		glow[0][n], glow[1][n], glow[2][n] = r*bright, g*bright, b*bright
+	}
+
+	column := make([]float64, h)
+	for _, p := range glow {
+		for pass := 0; pass < 2; pass++ {
+			for y := 0; y < h; y++ {
+				boxBlurRow(p[y*w:(y+1)*w], radius)
+			}
+			for x := 0; x < w; x++ {
+				for y := 0; y < h; y++ {
+					column[y] = p[y*w+x]
+				}
+				boxBlurRow(column, radius)
+				for y := 0; y < h; y++ {
+					p[y*w+x] = column[y]
+				}
+			}
+		}
+	}
+
+	for n := 0; n < w*h; n++ {
+		a := float64(pix[n*4+3]) / 255
+		for ch := range glow {
+			v := float64(pix[n*4+ch])/255 + strength*glow[ch][n]*a
+			// premultiplied, a channel can't exceed alpha
+			pix[n*4+ch] = gray(math.Min(v, a))
+		}
+	}
+}
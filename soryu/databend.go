@@ -0,0 +1,116 @@
+package soryu
+
+import (
+	"fmt"
+	"image/draw"
+	"math/bits"
+	"math/rand"
+)
+
+var databendOps = []string{"repeat", "delete", "insert", "xor", "and", "or", "reverse", "rotate"}
+
+// DatabendOptions configures Databend.
+type DatabendOptions struct {
+	// Ops are the operations to pick from: "repeat", "delete", "insert",
+	// "xor", "and", "or", "reverse" and "rotate". Empty uses all of them.
+	Ops []string
+	// Count is the number of operations applied
+	Count IntRange
+	// Span is the number of bytes every operation touches
+	Span IntRange
+	// Pattern is applied repeatedly by xor, and and or. A random byte is used
+	// per operation if it is empty.
+	Pattern []byte
+	// Rotate is the number of bits every byte is rotated left by, negative
+	// rotates right. 0 picks a random rotation per operation.
+	Rotate int
+	// KeepAlpha restores the alpha bytes after bending
+	KeepAlpha bool
+}
+
+// Databend edits the raw RGBA bytes of the image like a hex editor would. The
+// operations work on the whole buffer, so deleting or inserting bytes shifts
+// every following pixel and its channels.
+func (i *Img) Databend(o DatabendOptions) error {
+	ops := o.Ops
+	if len(ops) == 0 {
+		ops = databendOps
+	}
+	for _, op := range ops {
+		if !contains(databendOps, op) {
+			return fmt.Errorf("unknown databend operation %q", op)
+		}
+	}
+
+	b := i.Bounds
+	buf := cloneImage(i.Out)
+	pix := buf.Pix
+	if len(pix) == 0 {
+		return nil
+	}
+
+	count := o.Count.Rand()
+	for n := 0; n < count; n++ {
+		span := minInt(maxInt(o.Span.Rand(), 1), len(pix))
+		start := rand.Intn(len(pix) - span + 1)
+		bytes := pix[start : start+span]
+
+		switch op := ops[rand.Intn(len(ops))]; op {
+		case "repeat":
+			// the span is written again right after itself, pushing the rest
+			// of the buffer back
+			repeated := append([]byte(nil), bytes...)
+			copy(pix[start+span:], pix[start:])
+			copy(pix[start+span:], repeated)
+		case "delete":
+			// the tail keeps its old bytes where nothing is shifted in
+			copy(pix[start:], pix[start+span:])
+		case "insert":
+			copy(pix[start+span:], pix[start:])
+			rand.Read(bytes)
+		case "xor", "and", "or":
+			pattern := o.Pattern
+			if len(pattern) == 0 {
+				pattern = []byte{byte(rand.Intn(256))}
+			}
+			for k := range bytes {
+				p := pattern[k%len(pattern)]
+				switch op {
+				case "xor":
+					bytes[k] ^= p
+				case "and":
+					bytes[k] &= p
+				case "or":
+					bytes[k] |= p
+				}
+			}
+		case "reverse":
+			for a, c := 0, len(bytes)-1; a < c; a, c = a+1, c-1 {
+				bytes[a], bytes[c] = bytes[c], bytes[a]
+			}
+		case "rotate":
+			rot := o.Rotate
+			if rot == 0 {
+				rot = rand.Intn(7) + 1
+			}
+			for k := range bytes {
+				bytes[k] = bits.RotateLeft8(bytes[k], rot)
+			}
+		}
+	}
+
+	src := cloneImage(i.Out)
+	for p := 0; p < len(pix); p += 4 {
+		if o.KeepAlpha {
+			pix[p+3] = src.Pix[p+3]
+		}
+		// the buffer is premultiplied, no channel may be above alpha
+		for c := p; c < p+3; c++ {
+			if pix[c] > pix[p+3] {
+				pix[c] = pix[p+3]
+			}
+		}
+	}
+	draw.Draw(i.Out, b, buf, b.Min, draw.Src)
+	return nil
+}
@@ -0,0 +1,189 @@
+package soryu
+
+import (
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+// DCTGlitchOptions configures DCTGlitch. The probabilities are per 8x8 block.
+type DCTGlitchOptions struct {
+	// Zero is the probability of dropping all AC coefficients of a block
+	Zero float64
+	// Shuffle is the probability of shuffling the AC coefficients of a block
+	Shuffle float64
+	// Amplify is the probability of multiplying the AC coefficients of a
+	// block by Gain
+	Amplify float64
+	Gain    float64
+	// SwapDC is the probability of swapping the DC coefficient of a block with
+	// another random block
+	SwapDC float64
+	// LumaQuant and ChromaQuant quantize all coefficients of the Y and the
+	// Cb/Cr planes with the given step, 0 or 1 leaves them alone
+	LumaQuant   float64
+	ChromaQuant float64
+}
+
+// DCTGlitch transforms the image into 8x8 DCT blocks in YCbCr, mangles the
+// coefficients and transforms it back, giving macroblock artifacts.
+func (i *Img) DCTGlitch(o DCTGlitchOptions) {
+	b := i.Bounds
+	bw, bh := (b.Dx()+7)/8, (b.Dy()+7)/8
+
+	// Y, Cb, Cr planes of blocks, level shifted
+	var planes [3][][64]float64
+	for p := range planes {
+		planes[p] = make([][64]float64, bw*bh)
+	}
+	for by := 0; by < bh; by++ {
+		for bx := 0; bx < bw; bx++ {
+			for n := 0; n < 64; n++ {
+				// edge blocks repeat the last row and column of the image
+				x := minInt(b.Min.X+bx*8+n%8, b.Max.X-1)
+				y := minInt(b.Min.Y+by*8+n/8, b.Max.Y-1)
+				r, g, bl, _ := i.Out.At(x, y).RGBA()
+				yy, cb, cr := color.RGBToYCbCr(uint8(r>>8), uint8(g>>8), uint8(bl>>8))
+				planes[0][by*bw+bx][n] = float64(yy) - 128
+				planes[1][by*bw+bx][n] = float64(cb) - 128
+				planes[2][by*bw+bx][n] = float64(cr) - 128
+			}
+		}
+	}
+
+	for p := range planes {
+		blocks := planes[p]
+		for n := range blocks {
+			fdct(&blocks[n])
+		}
+
+		quant := o.LumaQuant
+		if p > 0 {
+			quant = o.ChromaQuant
+		}
+		for n := range blocks {
+			block := &blocks[n]
+			if rand.Float64() < o.Zero {
+				dc := block[0]
+				*block = [64]float64{}
+				block[0] = dc
+			}
+			if rand.Float64() < o.Shuffle {
+				rand.Shuffle(63, func(a, c int) {
+					block[a+1], block[c+1] = block[c+1], block[a+1]
+				})
+			}
+			if rand.Float64() < o.Amplify {
+				for k := 1; k < 64; k++ {
+					block[k] *= o.Gain
+				}
+			}
+			if rand.Float64() < o.SwapDC {
+				other := rand.Intn(len(blocks))
+				block[0], blocks[other][0] = blocks[other][0], block[0]
+			}
+			if quant > 1 {
+				for k := range block {
+					block[k] = math.Round(block[k]/quant) * quant
+				}
+			}
+		}
+
+		for n := range blocks {
+			idct(&blocks[n])
+		}
+	}
+
+	for by := 0; by < bh; by++ {
+		for bx := 0; bx < bw; bx++ {
+			for n := 0; n < 64; n++ {
+				x := b.Min.X + bx*8 + n%8
+				y := b.Min.Y + by*8 + n/8
+				if x >= b.Max.X || y >= b.Max.Y {
+					continue
+				}
+				sample := func(p int) uint8 {
+					return uint8(clamp01((planes[p][by*bw+bx][n]+128)/255)*255 + 0.5)
+				}
+				r, g, bl := color.YCbCrToRGB(sample(0), sample(1), sample(2))
+				_, _, _, a := i.Out.At(x, y).RGBA()
+				i.Out.Set(x, y, color.RGBA{r, g, bl, uint8(a >> 8)})
+			}
+		}
+	}
+}
+
+// unzig maps the zigzag order of jpeg coefficients to their natural order.
+var unzig = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// dctCos[x][u] is C(u) * cos((2x+1)uπ/16) / 2, the basis of the 8x8 DCT.
+var dctCos [8][8]float64
+
+func init() {
+	for x := 0; x < 8; x++ {
+		for u := 0; u < 8; u++ {
+			c := 1.0
+			if u == 0 {
+				c = 1 / math.Sqrt2
+			}
+			dctCos[x][u] = c * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16) / 2
+		}
+	}
+}
+
+// fdct turns a block of 64 level shifted samples into coefficients in natural
+// order.
+func fdct(block *[64]float64) {
+	var tmp [64]float64
+	for y := 0; y < 8; y++ {
+		for u := 0; u < 8; u++ {
+			var sum float64
+			for x := 0; x < 8; x++ {
+				sum += dctCos[x][u] * block[y*8+x]
+			}
+			tmp[y*8+u] = sum
+		}
+	}
+	for u := 0; u < 8; u++ {
+		for v := 0; v < 8; v++ {
+			var sum float64
+			for y := 0; y < 8; y++ {
+				sum += dctCos[y][v] * tmp[y*8+u]
+			}
+			block[v*8+u] = sum
+		}
+	}
+}
+
+// idct turns a block of 64 coefficients in natural order into samples,
+// without the level shift.
+func idct(block *[64]float64) {
+	var tmp [64]float64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			var sum float64
+			for u := 0; u < 8; u++ {
+				sum += dctCos[x][u] * block[y*8+u]
+			}
+			tmp[y*8+x] = sum
+		}
+	}
+	for x := 0; x < 8; x++ {
+		for y := 0; y < 8; y++ {
+			var sum float64
+			for v := 0; v < 8; v++ {
+				sum += dctCos[y][v] * tmp[v*8+x]
+			}
+			block[y*8+x] = sum
+		}
+	}
+}
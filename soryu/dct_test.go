@@ -0,0 +1,37 @@
+package soryu
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDCTRoundTrip(t *testing.T) {
+	var block [64]float64
+	for n := range block {
+		block[n] = float64(n*7%50) - 20
+	}
+	orig := block
+	fdct(&block)
+	idct(&block)
+	for n := range block {
+		if math.Abs(block[n]-orig[n]) > 1e-9 {
+			t.Fatalf("coefficient %d is %v after a round trip, want %v", n, block[n], orig[n])
+		}
+	}
+}
+
+func TestDCTFlatBlock(t *testing.T) {
+	var block [64]float64
+	for n := range block {
+		block[n] = 10
+	}
+	fdct(&block)
+	for n := 1; n < 64; n++ {
+		if math.Abs(block[n]) > 1e-9 {
+			t.Fatalf("flat block has AC coefficient %d = %v", n, block[n])
+		}
+	}
+	if block[0] == 0 {
+		t.Fatal("flat block has no DC coefficient")
+	}
+}
@@ -0,0 +1,159 @@
+package soryu
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/anthonynsimon/bild/perlin"
+)
+
+// DisplaceOptions are the sampling options shared by Wave and Turbulence.
+type DisplaceOptions struct {
+	// Bilinear interpolates between pixels, otherwise the nearest is used
+	Bilinear bool
+	// FromIn samples the original image instead of the glitched one
+	FromIn bool
+}
+
+// displaceOptions reads the sampling and source parameters of a step.
+func displaceOptions(s Step) (DisplaceOptions, error) {
+	sampling, source := s.String("sampling", "bilinear"), s.String("source", "out")
+	if sampling != "bilinear" && sampling != "nearest" {
+		return DisplaceOptions{}, fmt.Errorf("unknown sampling %q", sampling)
+	}
+	if source != "in" && source != "out" {
+		return DisplaceOptions{}, fmt.Errorf("unknown source %q", source)
+	}
+	return DisplaceOptions{Bilinear: sampling == "bilinear", FromIn: source == "in"}, nil
+}
+
+// WaveOptions configures Wave.
+type WaveOptions struct {
+	DisplaceOptions
+	// Columns displaces columns vertically instead of rows horizontally
+	Columns bool
+	// Amplitude of the wave in pixels
+	Amplitude float64
+	// Frequency is the number of waves across the image
+	Frequency float64
+	// Phase of the wave in degrees, PhaseSpeed is added to it every gif frame
+	Phase      float64
+	PhaseSpeed float64
+}
+
+// TurbulenceOptions configures Turbulence.
+type TurbulenceOptions struct {
+	DisplaceOptions
+	// Amplitude of the displacement in pixels
+	Amplitude float64
+	// Scale is roughly the size of the noise features in pixels
+	Scale   float64
+	Octaves int
+	// Offset moves through the noise field, OffsetSpeed is added to it every
+	// gif frame
+	Offset      float64
+	OffsetSpeed float64
+	// Seed of the noise field, kept fixed so the frames of a gif flow into
+	// each other
+	Seed int64
+}
+
+// Wave shifts every row (or column) of the image along a sine wave, like a
+// wobbling tape.
+func (i *Img) Wave(o WaveOptions) {
+	b := i.Bounds
+	phase := (o.Phase + o.PhaseSpeed*float64(i.Frame)) * math.Pi / 180
+	length := float64(b.Dy())
+	if o.Columns {
+		length = float64(b.Dx())
+	}
+
+	i.displace(o.DisplaceOptions, func(x, y int) (float64, float64) {
+		if o.Columns {
+			t := float64(x-b.Min.X) / length
+			return 0, o.Amplitude * math.Sin(2*math.Pi*o.Frequency*t+phase)
+		}
+		t := float64(y-b.Min.Y) / length
+		return o.Amplitude * math.Sin(2*math.Pi*o.Frequency*t+phase), 0
+	})
+}
+
+// Turbulence displaces the image by a perlin noise field, like heat haze.
+func (i *Img) Turbulence(o TurbulenceOptions) error {
+	if o.Scale <= 0 {
+		return fmt.Errorf("turbulence scale must be positive, got %v", o.Scale)
+	}
+	// two independent fields for x and y
+	px := perlin.NewPerlin(2, 2, o.Octaves, o.Seed)
+	py := perlin.NewPerlin(2, 2, o.Octaves, o.Seed+1)
+	z := o.Offset + o.OffsetSpeed*float64(i.Frame)
+
+	i.displace(o.DisplaceOptions, func(x, y int) (float64, float64) {
+		nx, ny := float64(x)/o.Scale, float64(y)/o.Scale
+		return o.Amplitude * px.Noise3D(nx, ny, z), o.Amplitude * py.Noise3D(nx, ny, z)
+	})
+	return nil
+}
+
+// displace sets every pixel to the pixel of the source offset by the given
+// displacement, clamped to the border.
+func (i *Img) displace(o DisplaceOptions, offset func(x, y int) (float64, float64)) {
+	b := i.Bounds
+	var src *image.RGBA
+	if o.FromIn {
+		src = image.NewRGBA(b)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				src.Set(x, y, i.In.At(x, y))
+			}
+		}
+	} else {
+		src = cloneImage(i.Out)
+	}
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			dx, dy := offset(x, y)
+			sx, sy := float64(x)+dx, float64(y)+dy
+			if o.Bilinear {
+				i.Out.Set(x, y, bilinear(src, sx, sy))
+			} else {
+				i.Out.Set(x, y, src.RGBAAt(clampX(b, int(math.Round(sx))), clampY(b, int(math.Round(sy)))))
+			}
+		}
+	}
+}
+
+func clampX(b image.Rectangle, x int) int {
+	return maxInt(b.Min.X, minInt(x, b.Max.X-1))
+}
+
+func clampY(b image.Rectangle, y int) int {
+	return maxInt(b.Min.Y, minInt(y, b.Max.Y-1))
+}
+
+// bilinear samples img at a position between pixels, clamped to the border.
+func bilinear(img *image.RGBA, x, y float64) color.RGBA {
+	b := img.Bounds()
+	x0, y0 := math.Floor(x), math.Floor(y)
+	fx, fy := x-x0, y-y0
+	ix, iy := int(x0), int(y0)
+
+	c00 := img.RGBAAt(clampX(b, ix), clampY(b, iy))
+	c10 := img.RGBAAt(clampX(b, ix+1), clampY(b, iy))
+	c01 := img.RGBAAt(clampX(b, ix), clampY(b, iy+1))
+	c11 := img.RGBAAt(clampX(b, ix+1), clampY(b, iy+1))
+	mix := func(a, b, c, d uint8) uint8 {
+		top := lerp(float64(a), float64(b), fx)
+		bottom := lerp(float64(c), float64(d), fx)
+		return uint8(lerp(top, bottom, fy) + 0.5)
+	}
+	return color.RGBA{
+		mix(c00.R, c10.R, c01.R, c11.R),
+		mix(c00.G, c10.G, c01.G, c11.G),
+		mix(c00.B, c10.B, c01.B, c11.B),
+		mix(c00.A, c10.A, c01.A, c11.A),
+	}
+}
@@ -0,0 +1,379 @@
+package soryu
+
+import (
+	"encoding/hex"
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// Effects maps effect names to a function applying them with the parameters
+// of a step. Parameters that are not set fall back to the same defaults as the
+// command line.
+var Effects = map[string]func(i *Img, s Step) error{
+	"Streak": func(i *Img, s Step) error {
+		angle := 0.0
+		if s.Bool("left", true) {
+			angle = 180
+		}
+		width := s.Int("width", 3)
+		i.StreakAngle(StreakOptions{
+			Amount: s.Int("amount", 10000),
+			Angle:  s.Float("angle", angle),
+			Jitter: s.Float("jitter", 0),
+			Length: s.IntRange("length", IntRange{width, width}),
+			Decay:  s.Float("decay", 0.75),
+		})
+		return nil
+	},
+	"Burst": func(i *Img, s Step) error {
+		i.Burst()
+		return nil
+	},
+	"ShiftChannel": func(i *Img, s Step) error {
+		i.ShiftChannel(s.Bool("left", false))
+		return nil
+	},
+	"Ghost": func(i *Img, s Step) error {
+		i.Ghost()
+		return nil
+	},
+	"GhostStretch": func(i *Img, s Step) error {
+		i.GhostStretch()
+		return nil
+	},
+	"ColorBoost": func(i *Img, s Step) error {
+		return i.ColorBoost(s.String("color", "red"), s.Float("strength", 0.3), s.String("mode", "tint"))
+	},
+	"Split": func(i *Img, s Step) error {
+		i.Split(s.Int("width", 3), s.Int("length", 50), false)
+		return nil
+	},
+	"VerticalSplit": func(i *Img, s Step) error {
+		i.VerticalSplit(s.Int("width", 3), s.Int("length", 50), false)
+		return nil
+	},
+	"Noise": func(i *Img, s Step) error {
+		i.Noise(s.String("color", "#c0ffee"))
+		return nil
+	},
+	"GaussianNoise": func(i *Img, s Step) error {
+		i.GaussianNoise()
+		return nil
+	},
+	"Scanlines": func(i *Img, s Step) error {
+		i.Scanlines()
+		return nil
+	},
+	"BigLines": func(i *Img, s Step) error {
+		i.BigLines()
+		return nil
+	},
+	"CopyChannelBigLines": func(i *Img, s Step) error {
+		i.CopyChannelBigLines()
+		return nil
+	},
+	"RandomCorruptions": func(i *Img, s Step) error {
+		i.RandomCorruptions(s.Bool("uniform", false))
+		return nil
+	},
+	"OverlayImage": func(i *Img, s Step) error {
+		path := s.String("image", "")
+		if path == "" {
+			return fmt.Errorf("OverlayImage needs an image parameter")
+		}
+		i.OverlayImage(path)
+		return nil
+	},
+	"PixelSort": func(i *Img, s Step) error {
+		angle := s.Float("angle", 0)
+		if s.String("direction", "rows") == "columns" {
+			angle = 90
+		}
+		i.PixelSort(PixelSortOptions{
+			Angle:        angle,
+			Threshold:    s.String("threshold", "brightness"),
+			Lower:        s.Float("lower", 0.25),
+			Upper:        s.Float("upper", 0.8),
+			SortBy:       s.String("by", "luminance"),
+			Reverse:      s.Bool("reverse", false),
+			RandomLength: s.Int("random", 0),
+		})
+		return nil
+	},
+	"JPEGCorrupt": func(i *Img, s Step) error {
+		return i.JPEGCorrupt(JPEGCorruptOptions{
+			Quality: s.Int("quality", 75),
+			Flips:   s.Int("flips", 10),
+			Repeats: s.Int("repeats", 2),
+			Zeros:   s.Int("zeros", 2),
+		})
+	},
+	"DCTGlitch": func(i *Img, s Step) error {
+		i.DCTGlitch(DCTGlitchOptions{
+			Zero:        s.Float("zero", 0.1),
+			Shuffle:     s.Float("shuffle", 0.02),
+			Amplify:     s.Float("amplify", 0.05),
+			Gain:        s.Float("gain", 4),
+			SwapDC:      s.Float("swap-dc", 0.01),
+			LumaQuant:   s.Float("luma-quant", 0),
+			ChromaQuant: s.Float("chroma-quant", 60),
+		})
+		return nil
+	},
+	"PNGCorrupt": func(i *Img, s Step) error {
+		return i.PNGCorrupt(PNGCorruptOptions{
+			Filter:      s.String("filter", "paeth"),
+			FilterFlips: s.Int("filter-flips", 10),
+			DataFlips:   s.Int("data-flips", 20),
+		})
+	},
+	"Databend": func(i *Img, s Step) error {
+		var ops []string
+		if v := s.String("ops", ""); v != "" {
+			ops = strings.Split(v, "+")
+		}
+		pattern, err := hex.DecodeString(s.String("pattern", ""))
+		if err != nil {
+			return fmt.Errorf("invalid databend pattern: %w", err)
+		}
+		return i.Databend(DatabendOptions{
+			Ops:       ops,
+			Count:     s.IntRange("count", IntRange{5, 20}),
+			Span:      s.IntRange("span", IntRange{16, 4096}),
+			Pattern:   pattern,
+			Rotate:    s.Int("rotate", 0),
+			KeepAlpha: s.Bool("keep-alpha", true),
+		})
+	},
+	"Reinterpret": func(i *Img, s Step) error {
+		x, y := s.Int("region-x", 0), s.Int("region-y", 0)
+		w, h := s.Int("region-width", 0), s.Int("region-height", 0)
+		var region image.Rectangle
+		if w > 0 && h > 0 {
+			region = image.Rect(x, y, x+w, y+h).Add(i.Bounds.Min)
+		}
+		return i.Reinterpret(ReinterpretOptions{
+			Stride:        s.Int("stride", 0),
+			WidthOffset:   s.Int("width-offset", 7),
+			Order:         s.String("order", "rgba"),
+			BytesPerPixel: s.Int("bpp", 4),
+			Region:        region,
+		})
+	},
+	"Sonify": func(i *Img, s Step) error {
+		return i.Sonify(SonifyOptions{
+			Traversal: s.String("traversal", "rows"),
+			Filters:   strings.Split(s.String("filters", "echo"), "+"),
+			Delay:     s.Int("delay", 300),
+			Feedback:  s.Float("feedback", 0.5),
+			Mix:       s.Float("mix", 0.5),
+			Cutoff:    s.Float("cutoff", 0.05),
+			Q:         s.Float("q", 0.707),
+			Rate:      s.Float("rate", 1),
+			Depth:     s.Float("depth", 1),
+			Drive:     s.Float("drive", 3),
+		})
+	},
+	"ChromaticAberration": func(i *Img, s Step) error {
+		return i.ChromaticAberration(ChromaticAberrationOptions{
+			Offsets: [3]image.Point{
+				{s.Int("red-x", -6), s.Int("red-y", 0)},
+				{s.Int("green-x", 0), s.Int("green-y", 0)},
+				{s.Int("blue-x", 6), s.Int("blue-y", 0)},
+			},
+			Radial:  s.Bool("radial", false),
+			Amounts: [3]float64{s.Float("red", 8), s.Float("green", 0), s.Float("blue", -8)},
+			CenterX: s.Float("center-x", 0.5),
+			CenterY: s.Float("center-y", 0.5),
+			Edge:    s.String("edge", "clamp"),
+		})
+	},
+	"Swizzle": func(i *Img, s Step) error {
+		// the mapping is given as one parameter per channel, as commas
+		// separate steps
+		space := s.String("space", "rgb")
+		names := swizzleSpaces[space]
+		var mapping []string
+		for _, name := range append(names[:], "alpha") {
+			if v, ok := s.Params[name]; ok {
+				mapping = append(mapping, name+"="+v)
+			}
+		}
+		return i.Swizzle(strings.Join(mapping, ","), space)
+	},
+	"Wave": func(i *Img, s Step) error {
+		d, err := displaceOptions(s)
+		if err != nil {
+			return err
+		}
+		i.Wave(WaveOptions{
+			DisplaceOptions: d,
+			Columns:         s.String("direction", "rows") == "columns",
+			Amplitude:       s.Float("amplitude", 10),
+			Frequency:       s.Float("frequency", 3),
+			Phase:           s.Float("phase", 0),
+			PhaseSpeed:      s.Float("phase-speed", 36),
+		})
+		return nil
+	},
+	"Turbulence": func(i *Img, s Step) error {
+		d, err := displaceOptions(s)
+		if err != nil {
+			return err
+		}
+		return i.Turbulence(TurbulenceOptions{
+			DisplaceOptions: d,
+			Amplitude:       s.Float("amplitude", 15),
+			Scale:           s.Float("scale", 80),
+			Octaves:         s.Int("octaves", 3),
+			Offset:          s.Float("offset", 0),
+			OffsetSpeed:     s.Float("offset-speed", 0.1),
+			Seed:            int64(s.Int("seed", 1)),
+		})
+	},
+	"Macroblock": func(i *Img, s Step) error {
+		var ops []string
+		if v := s.String("ops", ""); v != "" {
+			ops = strings.Split(v, "+")
+		}
+		size := 0
+		if s.String("size", "") != "random" {
+			size = s.Int("size", 16)
+		}
+		return i.Macroblock(MacroblockOptions{
+			Size:            size,
+			Ops:             ops,
+			Density:         s.Float("density", 0.1),
+			MaxDisplacement: s.Int("max-displacement", 64),
+			Smear:           s.Bool("smear", false),
+		})
+	},
+	"VHS": func(i *Img, s Step) error {
+		i.VHS(VHSOptions{
+			ChromaBleed:   s.Float("chroma-bleed", 6),
+			Sharpen:       s.Float("sharpen", 1),
+			Tracking:      s.Float("tracking", 0.5),
+			TrackingSpeed: s.Float("tracking-speed", 0.1),
+			HeadSwitch:    s.Float("head-switch", 0.5),
+			Dropouts:      s.Float("dropouts", 0.3),
+			Wobble:        s.Float("wobble", 1.5),
+		})
+		return nil
+	},
+	"CRT": func(i *Img, s Step) error {
+		return i.CRT(CRTOptions{
+			Curvature:         s.Float("curvature", 0.1),
+			ScanlineSpacing:   s.Float("scanline-spacing", 2),
+			ScanlineThickness: s.Float("scanline-thickness", 0.5),
+			ScanlineDarkness:  s.Float("scanline-darkness", 0.4),
+			Mask:              s.String("phosphor", "grille"),
+			MaskStrength:      s.Float("phosphor-strength", 0.3),
+			Bloom:             s.Float("bloom", 0.6),
+			Vignette:          s.Float("vignette", 0.4),
+			Misconvergence:    s.Float("misconvergence", 0.5),
+		})
+	},
+	"Interlace": func(i *Img, s Step) error {
+		i.Interlace(InterlaceOptions{
+			Offset:        s.Int("offset", 4),
+			Comb:          s.Float("comb", 12),
+			Double:        s.Bool("double", false),
+			PreviousField: s.Bool("previous-field", true),
+		})
+		return nil
+	},
+	"Stretch": func(i *Img, s Step) error {
+		direction := s.String("direction", "right")
+		if s.String("mode", "stretch") == "slitscan" {
+			return i.SlitScan(direction, s.Int("slit", 0), s.Int("speed", 8))
+		}
+		var at []int
+		for _, v := range strings.Split(s.String("at", ""), "+") {
+			if n, err := strconv.Atoi(v); err == nil {
+				at = append(at, n)
+			}
+		}
+		return i.Stretch(StretchOptions{
+			Direction: direction,
+			At:        at,
+			Count:     s.Int("count", 3),
+			Length:    s.IntRange("length", IntRange{20, 200}),
+		})
+	},
+	"BandShift": func(i *Img, s Step) error {
+		return i.BandShift(BandShiftOptions{
+			Angle:     s.Float("angle", 0),
+			Width:     s.IntRange("width", IntRange{3, 30}),
+			Offset:    s.IntRange("offset", IntRange{-50, 50}),
+			Alternate: s.Bool("alternate", false),
+			Edge:      s.String("edge", "wrap"),
+			FromIn:    s.String("source", "out") == "in",
+		})
+	},
+	"Posterize": func(i *Img, s Step) error {
+		return i.Posterize(s.Int("levels", 4), toneOptions(s))
+	},
+	"Solarize": func(i *Img, s Step) error {
+		return i.Solarize(s.Float("threshold", 0.5), toneOptions(s))
+	},
+	"Invert": func(i *Img, s Step) error {
+		return i.Invert(toneOptions(s))
+	},
+	"BitCrush": func(i *Img, s Step) error {
+		mask, err := strconv.ParseUint(s.String("bit-mask", "ff"), 16, 8)
+		if err != nil {
+			return fmt.Errorf("invalid bit mask: %w", err)
+		}
+		return i.BitCrush(BitCrushOptions{
+			Bits:    s.Int("bits", 3),
+			Mask:    uint8(mask),
+			Shuffle: s.Bool("shuffle", false),
+		}, toneOptions(s))
+	},
+	"Curves": func(i *Img, s Step) error {
+		points, err := ParseCurve(s.String("points", "0/0+0.25/0.15+0.75/0.85+1/1"))
+		if err != nil {
+			return err
+		}
+		return i.Curves(points, toneOptions(s))
+	},
+	"GradientMap": func(i *Img, s Step) error {
+		gradient := s.String("stops", "#000000+#ffffff")
+		if preset := s.String("preset", ""); preset != "" {
+			var ok bool
+			if gradient, ok = GradientPresets[preset]; !ok {
+				return fmt.Errorf("unknown gradient preset %q", preset)
+			}
+		}
+		stops, err := ParseGradient(gradient)
+		if err != nil {
+			return err
+		}
+		// the step's opacity already fades the result in
+		return i.GradientMap(GradientMapOptions{
+			Stops:   stops,
+			Space:   s.String("space", "lab"),
+			Opacity: 1,
+		})
+	},
+}
+
+// Apply runs the effect named by the step on the image, honouring the step's
+// mask, blend mode and opacity.
+func (i *Img) Apply(s Step) error {
+	fn, ok := Effects[s.Effect]
+	if !ok {
+		return fmt.Errorf("unknown effect %q", s.Effect)
+	}
+	if s.err == nil {
+		s.err = new(error)
+	}
+
+	var err error
+	if stepErr := i.ApplyStep(s, func() { err = fn(i, s) }); stepErr != nil {
+		return stepErr
+	}
+	return err
+}
@@ -0,0 +1,143 @@
+package soryu
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+
+	colorful "github.com/lucasb-eyer/go-colorful"
+)
+
+// GradientStop is a color of a gradient at a position from 0 to 1.
+type GradientStop struct {
+	Color    color.RGBA
+	Position float64
+}
+
+// GradientMapOptions configures GradientMap.
+type GradientMapOptions struct {
+	// Stops of the gradient, the darkest pixels get the color at 0 and the
+	// brightest the color at 1
+	Stops []GradientStop
+	// Space the colors are interpolated in: "rgb", "lab" or "hcl"
+	Space string
+	// Opacity of the mapped colors over the image (0-1)
+	Opacity float64
+}
+
+// GradientPresets are duotone and tritone gradients for GradientMap.
+var GradientPresets = map[string]string{
+	"cyber":  "#0d0221+#ff2a6d",
+	"mint":   "#1b2a49+#7fffd4",
+	"sepia":  "#2b1d0e+#f3e0c0",
+	"sunset": "#2b1055+#d53369+#ffcc70",
+	"toxic":  "#000000+#39ff14+#ffffff",
+	"vapor":  "#2d1b69+#ff71ce+#01cdfe",
+}
+
+// GradientMap replaces every pixel with the color of the gradient at its
+// luminance, keeping its alpha.
+func (i *Img) GradientMap(o GradientMapOptions) error {
+	if len(o.Stops) < 2 {
+		return fmt.Errorf("a gradient needs at least 2 stops, got %d", len(o.Stops))
+	}
+	var mix func(a, b colorful.Color, t float64) colorful.Color
+	switch o.Space {
+	case "rgb":
+		mix = colorful.Color.BlendRgb
+	case "lab":
+		mix = colorful.Color.BlendLab
+	case "hcl":
+		mix = colorful.Color.BlendHcl
+	default:
+		return fmt.Errorf("unknown gradient space %q", o.Space)
+	}
+
+	stops := append([]GradientStop(nil), o.Stops...)
+	sort.SliceStable(stops, func(a, b int) bool { return stops[a].Position < stops[b].Position })
+	stop := func(n int) colorful.Color {
+		c, _ := colorful.MakeColor(stops[n].Color)
+		return c
+	}
+	last := len(stops) - 1
+	at := func(t float64) colorful.Color {
+		if t <= stops[0].Position {
+			return stop(0)
+		}
+		if t >= stops[last].Position {
+			return stop(last)
+		}
+		k := sort.Search(len(stops), func(k int) bool { return stops[k].Position > t }) - 1
+		d := stops[k+1].Position - stops[k].Position
+		return mix(stop(k), stop(k+1), (t-stops[k].Position)/d).Clamped()
+	}
+
+	// one color for every 8 bit luminance
+	var table [256]colorful.Color
+	for n := range table {
+		table[n] = at(float64(n) / 255)
+	}
+
+	b := i.Bounds
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			p := color.NRGBAModel.Convert(i.Out.At(x, y)).(color.NRGBA)
+			l := color.GrayModel.Convert(color.NRGBA{p.R, p.G, p.B, 0xff}).(color.Gray).Y
+			g := table[l]
+			i.Out.Set(x, y, color.NRGBA{
+				gray(lerp(float64(p.R)/255, g.R, o.Opacity)),
+				gray(lerp(float64(p.G)/255, g.G, o.Opacity)),
+				gray(lerp(float64(p.B)/255, g.B, o.Opacity)),
+				p.A,
+			})
+		}
+	}
+	return nil
+}
+
+// ParseGradient parses gradient stops written as "#000000/0+#ff0066/0.3+#ffffff",
+// hex colors with optional positions joined by "+". Stops without a position
+// are spread evenly between their neighbours, the first and last default to 0
+// and 1.
+func ParseGradient(s string) ([]GradientStop, error) {
+	parts := strings.Split(s, "+")
+	stops := make([]GradientStop, len(parts))
+	known := make([]bool, len(parts))
+	for n, p := range parts {
+		hex, pos, hasPos := strings.Cut(p, "/")
+		c, err := ParseHexColor(hex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gradient color %q: %w", hex, err)
+		}
+		stops[n].Color = c
+		if hasPos {
+			v, err := strconv.ParseFloat(pos, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid gradient position %q", pos)
+			}
+			stops[n].Position, known[n] = v, true
+		}
+	}
+
+	last := len(stops) - 1
+	if !known[0] {
+		stops[0].Position, known[0] = 0, true
+	}
+	if !known[last] {
+		stops[last].Position, known[last] = 1, true
+	}
+	for from := 0; from < last; {
+		to := from + 1
+		for !known[to] {
+			to++
+		}
+		for n := from + 1; n < to; n++ {
+			t := float64(n-from) / float64(to-from)
+			stops[n].Position = lerp(stops[from].Position, stops[to].Position, t)
+		}
+		from = to
+	}
+	return stops, nil
+}
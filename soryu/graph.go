@@ -0,0 +1,339 @@
+package soryu
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Node types of a Graph.
+const (
+	// SourceNode outputs the input image, or the file given by its path parameter
+	SourceNode = "source"
+	// EffectNode applies an effect to its first input, an optional second input
+	// is used as mask
+	EffectNode = "effect"
+	// MaskNode builds a mask from its input using the mask parameters of a step
+	MaskNode = "mask"
+	// BlendNode composites its second input over the first, an optional third
+	// input is used as mask
+	BlendNode = "blend"
+)
+
+// Node is a single node of a Graph.
+type Node struct {
+	ID     string            `json:"id"`
+	Type   string            `json:"type"`
+	Effect string            `json:"effect,omitempty"`
+	Inputs []string          `json:"inputs,omitempty"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// Graph is an effect pipeline that can branch and merge. Results of every node
+// are cached, so running the graph again only recomputes the nodes whose
+// definition, inputs or seed changed. Running it once per gif frame gives every
+// effect node the image of its input and its own result from the last run as
+// Previous and PreviousResult.
+type Graph struct {
+	Output string `json:"output"`
+	Nodes  []Node `json:"nodes"`
+
+	nodes map[string]*Node
+	cache map[uint64]image.Image
+	// last holds the result of every node of the last run by id
+	last map[string]image.Image
+}
+
+// LoadGraph reads and validates a json recipe file.
+func LoadGraph(path string) (*Graph, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadGraph(f)
+}
+
+// ReadGraph decodes and validates a json recipe.
+func ReadGraph(r io.Reader) (*Graph, error) {
+	var g Graph
+	if err := json.NewDecoder(r).Decode(&g); err != nil {
+		return nil, err
+	}
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// Validate checks the graph for unknown node types and effects, missing or
+// superfluous inputs and cycles.
+func (g *Graph) Validate() error {
+	g.nodes = map[string]*Node{}
+	for n := range g.Nodes {
+		node := &g.Nodes[n]
+		if node.ID == "" {
+			return fmt.Errorf("node %d has no id", n)
+		}
+		if _, ok := g.nodes[node.ID]; ok {
+			return fmt.Errorf("duplicate node %q", node.ID)
+		}
+		g.nodes[node.ID] = node
+	}
+
+	for _, node := range g.Nodes {
+		min, max := 0, 0
+		switch node.Type {
+		case SourceNode:
+		case EffectNode:
+			if _, ok := Effects[node.Effect]; !ok {
+				return fmt.Errorf("node %q: unknown effect %q", node.ID, node.Effect)
+			}
+			min, max = 1, 2
+		case MaskNode:
+			min, max = 1, 1
+		case BlendNode:
+			min, max = 2, 3
+		default:
+			return fmt.Errorf("node %q: unknown type %q", node.ID, node.Type)
+		}
+		if len(node.Inputs) < min || len(node.Inputs) > max {
+			return fmt.Errorf("node %q: %s nodes take %d to %d inputs, got %d", node.ID, node.Type, min, max, len(node.Inputs))
+		}
+		for _, in := range node.Inputs {
+			if _, ok := g.nodes[in]; !ok {
+				return fmt.Errorf("node %q: missing input %q", node.ID, in)
+			}
+		}
+	}
+
+	if _, ok := g.nodes[g.Output]; !ok {
+		return fmt.Errorf("missing output node %q", g.Output)
+	}
+
+	// depth first search, a node that is reached again while it is still
+	// being visited closes a cycle
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	var visit func(id string, path []string) error
+	visit = func(id string, path []string) error {
+		switch state[id] {
+		case visiting:
+			return fmt.Errorf("cycle: %s -> %s", strings.Join(path, " -> "), id)
+		case done:
+			return nil
+		}
+		state[id] = visiting
+		for _, in := range g.nodes[id].Inputs {
+			if err := visit(in, append(path, id)); err != nil {
+				return err
+			}
+		}
+		state[id] = done
+		return nil
+	}
+	for _, node := range g.Nodes {
+		if err := visit(node.ID, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run executes the graph on src and returns the output node's image. Every
+// node is seeded from seed and its definition, so equal nodes give equal
+// results and can be reused from the cache.
+func (g *Graph) Run(src *Img, seed int64) (*Img, error) {
+	if g.nodes == nil {
+		if err := g.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if g.cache == nil {
+		g.cache = map[uint64]image.Image{}
+	}
+
+	srcKey := fnv.New64a()
+	srcKey.Write(cloneImage(src.Out).Pix)
+	fmt.Fprint(srcKey, seed, src.Frame)
+
+	// results of this run by node id, so inputs shared by several nodes are
+	// only walked once
+	type result struct {
+		img image.Image
+		key uint64
+	}
+	results := map[string]result{}
+	used := map[uint64]bool{}
+	var eval func(id string) (image.Image, uint64, error)
+	eval = func(id string) (image.Image, uint64, error) {
+		if r, ok := results[id]; ok {
+			return r.img, r.key, nil
+		}
+		node := g.nodes[id]
+
+		var inputs []image.Image
+		h := fnv.New64a()
+		h.Write(srcKey.Sum(nil))
+		for _, in := range node.Inputs {
+			img, key, err := eval(in)
+			if err != nil {
+				return nil, 0, err
+			}
+			inputs = append(inputs, img)
+			fmt.Fprint(h, key)
+		}
+		writeNode(h, node)
+		key := h.Sum64()
+		used[key] = true
+
+		if img, ok := g.cache[key]; ok {
+			results[id] = result{img, key}
+			return img, key, nil
+		}
+
+		var previous image.Image
+		if len(node.Inputs) > 0 {
+			previous = g.last[node.Inputs[0]]
+		}
+		rand.Seed(int64(key))
+		img, err := g.runNode(node, src, inputs, previous, g.last[id])
+		if err != nil {
+			return nil, 0, fmt.Errorf("node %q: %w", id, err)
+		}
+		g.cache[key] = img
+		results[id] = result{img, key}
+		return img, key, nil
+	}
+
+	out, _, err := eval(g.Output)
+	if err != nil {
+		return nil, err
+	}
+
+	// drop results of nodes that are no longer part of the graph
+	for key := range g.cache {
+		if !used[key] {
+			delete(g.cache, key)
+		}
+	}
+	g.last = map[string]image.Image{}
+	for id, r := range results {
+		g.last[id] = r.img
+	}
+
+	return &Img{
+		In:       src.In,
+		Out:      cloneImage(out),
+		Bounds:   src.Bounds,
+		Imgtype:  src.Imgtype,
+		Frame:    src.Frame,
+		Previous: src.Previous,
+	}, nil
+}
+
+func (g *Graph) runNode(node *Node, src *Img, inputs []image.Image, previous, previousResult image.Image) (image.Image, error) {
+	s := Step{Effect: node.Effect, Params: node.Params, err: new(error)}
+	if s.Params == nil {
+		s.Params = map[string]string{}
+	}
+
+	switch node.Type {
+	case SourceNode:
+		path := s.String("path", "")
+		if path == "" {
+			return cloneImage(src.Out), nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		img, _, err := image.Decode(f)
+		if err != nil {
+			return nil, err
+		}
+		return cloneImage(img), nil
+	case EffectNode:
+		i := &Img{
+			In:             inputs[0],
+			Out:            cloneImage(inputs[0]),
+			Bounds:         inputs[0].Bounds(),
+			Imgtype:        src.Imgtype,
+			Frame:          src.Frame,
+			Previous:       previous,
+			PreviousResult: previousResult,
+		}
+		if len(inputs) == 1 {
+			if err := i.Apply(s); err != nil {
+				return nil, err
+			}
+			return i.Out, nil
+		}
+		var err error
+		stepErr := i.applyMasked(s, grayImage(inputs[1]), func() {
+			err = Effects[node.Effect](i, s)
+		})
+		if stepErr != nil {
+			return nil, stepErr
+		}
+		if err != nil {
+			return nil, err
+		}
+		return i.Out, nil
+	case MaskNode:
+		i := &Img{In: inputs[0], Out: cloneImage(inputs[0]), Bounds: inputs[0].Bounds()}
+		mask, err := s.Mask(i)
+		if err != nil {
+			return nil, err
+		}
+		if mask == nil {
+			return nil, fmt.Errorf("mask node without mask parameter")
+		}
+		if s.Bool("invert", false) {
+			mask = invertMask(mask)
+		}
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+		return mask, nil
+	case BlendNode:
+		opacity := s.Float("opacity", 1)
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+		out, err := Composite(inputs[0], inputs[1], s.String("blend", "normal"), opacity)
+		if err != nil {
+			return nil, err
+		}
+		if len(inputs) == 3 {
+			bg := cloneImage(inputs[0])
+			drawMasked(bg, out, grayImage(inputs[2]))
+			return bg, nil
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", node.Type)
+}
+
+// writeNode hashes the definition of a node, params in a stable order.
+func writeNode(w io.Writer, node *Node) {
+	fmt.Fprint(w, node.Type, "\x00", node.Effect, "\x00")
+	var keys []string
+	for k := range node.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprint(w, k, "=", node.Params[k], "\x00")
+	}
+}
@@ -0,0 +1,201 @@
+package soryu
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"strings"
+	"testing"
+)
+
+func testImg() *Img {
+	src := testImage(32, 24)
+	return &Img{In: src, Out: cloneImage(src), Bounds: src.Bounds(), Imgtype: "png"}
+}
+
+func TestReadGraphValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		recipe string
+		err    string
+	}{
+		{
+			name: "valid",
+			recipe: `{"output": "out", "nodes": [
+				{"id": "src", "type": "source"},
+				{"id": "noise", "type": "effect", "effect": "Noise", "inputs": ["src"]},
+				{"id": "m", "type": "mask", "inputs": ["src"], "params": {"mask": "radial"}},
+				{"id": "out", "type": "blend", "inputs": ["src", "noise", "m"], "params": {"blend": "screen"}}
+			]}`,
+		},
+		{
+			name: "cycle",
+			recipe: `{"output": "c", "nodes": [
+				{"id": "src", "type": "source"},
+				{"id": "a", "type": "blend", "inputs": ["src", "c"]},
+				{"id": "b", "type": "effect", "effect": "Noise", "inputs": ["a"]},
+				{"id": "c", "type": "effect", "effect": "Noise", "inputs": ["b"]}
+			]}`,
+			err: "cycle",
+		},
+		{
+			name: "self cycle",
+			recipe: `{"output": "a", "nodes": [
+				{"id": "a", "type": "effect", "effect": "Noise", "inputs": ["a"]}
+			]}`,
+			err: "cycle",
+		},
+		{
+			name: "missing input",
+			recipe: `{"output": "a", "nodes": [
+				{"id": "a", "type": "effect", "effect": "Noise", "inputs": ["nope"]}
+			]}`,
+			err: `missing input "nope"`,
+		},
+		{
+			name: "missing output",
+			recipe: `{"output": "out", "nodes": [
+				{"id": "src", "type": "source"}
+			]}`,
+			err: `missing output node "out"`,
+		},
+		{
+			name: "effect without input",
+			recipe: `{"output": "a", "nodes": [
+				{"id": "a", "type": "effect", "effect": "Noise"}
+			]}`,
+			err: "take 1 to 2 inputs, got 0",
+		},
+		{
+			name: "blend with one input",
+			recipe: `{"output": "b", "nodes": [
+				{"id": "src", "type": "source"},
+				{"id": "b", "type": "blend", "inputs": ["src"]}
+			]}`,
+			err: "take 2 to 3 inputs, got 1",
+		},
+		{
+			name: "mask with two inputs",
+			recipe: `{"output": "m", "nodes": [
+				{"id": "src", "type": "source"},
+				{"id": "m", "type": "mask", "inputs": ["src", "src"]}
+			]}`,
+			err: "take 1 to 1 inputs, got 2",
+		},
+		{
+			name: "unknown effect",
+			recipe: `{"output": "a", "nodes": [
+				{"id": "src", "type": "source"},
+				{"id": "a", "type": "effect", "effect": "Nope", "inputs": ["src"]}
+			]}`,
+			err: `unknown effect "Nope"`,
+		},
+		{
+			name: "unknown type",
+			recipe: `{"output": "a", "nodes": [
+				{"id": "a", "type": "nope"}
+			]}`,
+			err: `unknown type "nope"`,
+		},
+		{
+			name: "duplicate id",
+			recipe: `{"output": "a", "nodes": [
+				{"id": "a", "type": "source"},
+				{"id": "a", "type": "source"}
+			]}`,
+			err: `duplicate node "a"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadGraph(strings.NewReader(tt.recipe))
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.err != "" && err == nil:
+				t.Fatalf("expected an error containing %q", tt.err)
+			case tt.err != "" && !strings.Contains(err.Error(), tt.err):
+				t.Fatalf("error %q doesn't contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+const testRecipe = `{"output": "out", "nodes": [
+	{"id": "src", "type": "source"},
+	{"id": "streak", "type": "effect", "effect": "Streak", "inputs": ["src"], "params": {"amount": "50"}},
+	{"id": "noise", "type": "effect", "effect": "Noise", "inputs": ["src"]},
+	{"id": "out", "type": "blend", "inputs": ["streak", "noise"], "params": {"blend": "difference"}}
+]}`
+
+func runTestGraph(t *testing.T, g *Graph, seed int64) []byte {
+	t.Helper()
+	out, err := g.Run(testImg(), seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cloneImage(out.Out).Pix
+}
+
+func TestGraphRunSeed(t *testing.T) {
+	read := func() *Graph {
+		g, err := ReadGraph(strings.NewReader(testRecipe))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return g
+	}
+
+	first := runTestGraph(t, read(), 7)
+	if again := runTestGraph(t, read(), 7); !bytes.Equal(first, again) {
+		t.Fatal("same seed gave a different image")
+	}
+	// the second run comes from the cache and must not differ either
+	g := read()
+	runTestGraph(t, g, 7)
+	if cached := runTestGraph(t, g, 7); !bytes.Equal(first, cached) {
+		t.Fatal("cached run gave a different image")
+	}
+	if other := runTestGraph(t, read(), 8); bytes.Equal(first, other) {
+		t.Fatal("different seeds gave the same image")
+	}
+}
+
+func TestGraphRunSharedInputs(t *testing.T) {
+	// every level blends the level below with itself, without memoizing the
+	// inputs this walks 2^levels paths
+	const levels = 40
+	var recipe strings.Builder
+	fmt.Fprintf(&recipe, `{"output": "l%d", "nodes": [{"id": "l0", "type": "source"}`, levels)
+	for n := 1; n <= levels; n++ {
+		fmt.Fprintf(&recipe, `, {"id": "l%d", "type": "blend", "inputs": ["l%d", "l%d"]}`, n, n-1, n-1)
+	}
+	recipe.WriteString("]}")
+
+	g, err := ReadGraph(strings.NewReader(recipe.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := testImg()
+	out, err := g.Run(src, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Out.Bounds() != image.Rect(0, 0, 32, 24) {
+		t.Fatalf("bounds %v", out.Out.Bounds())
+	}
+}
+
+func TestGraphRunInvalidParams(t *testing.T) {
+	g, err := ReadGraph(strings.NewReader(`{"output": "out", "nodes": [
+		{"id": "src", "type": "source"},
+		{"id": "noise", "type": "effect", "effect": "Noise", "inputs": ["src"]},
+		{"id": "out", "type": "blend", "inputs": ["src", "noise"], "params": {"opacity": "half"}}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Run(testImg(), 1); err == nil || !strings.Contains(err.Error(), `invalid opacity "half"`) {
+		t.Fatalf("got error %v", err)
+	}
+}
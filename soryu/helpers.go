@@ -2,7 +2,9 @@ package soryu
 
 import (
 	"fmt"
+	"image"
 	"image/color"
+	"image/draw"
 	"math/rand"
 )
 
@@ -16,10 +18,6 @@ func RandomChannel() Channel {
 	return Blue
 }
 
-func c(a uint32) uint8 {
-	return uint8((float64(a) / MAXC) * 255)
-}
-
 func minInt(a, b int) int {
 	if a < b {
 		return a
@@ -27,6 +25,60 @@ func minInt(a, b int) int {
 	return b
 }
 
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func clamp01(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
+
+// gray converts a value in [0, 1] to an 8 bit gray level.
+func gray(v float64) uint8 {
+	return uint8(clamp01(v)*255 + 0.5)
+}
+
+func lerp(a, b, t float64) float64 {
+	return a + (b-a)*t
+}
+
+func smoothstep(t float64) float64 {
+	return t * t * (3 - 2*t)
+}
+
+// cloneImage returns an RGBA copy of src with the same bounds.
+func cloneImage(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(b)
+	draw.Draw(dst, b, src, b.Min, draw.Src)
+	return dst
+}
+
 func ParseHexColor(s string) (c color.RGBA, err error) {
 	c.A = 0xff
 	switch len(s) {
@@ -48,18 +100,18 @@ func shiftColor(in color.Color, left int) (out color.RGBA) {
 	r, g, b, a := in.RGBA()
 
 	shiftedColor = color.RGBA{
-		R: uint8(b),
-		G: uint8(r),
-		B: uint8(g),
-		A: uint8(a),
+		R: uint8(b >> 8),
+		G: uint8(r >> 8),
+		B: uint8(g >> 8),
+		A: uint8(a >> 8),
 	}
 
 	if left == 1 {
 		shiftedColor = color.RGBA{
-			R: uint8(g),
-			G: uint8(b),
-			B: uint8(r),
-			A: uint8(a),
+			R: uint8(g >> 8),
+			G: uint8(b >> 8),
+			B: uint8(r >> 8),
+			A: uint8(a >> 8),
 		}
 	}
 
@@ -0,0 +1,60 @@
+package soryu
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// InterlaceOptions configures Interlace.
+type InterlaceOptions struct {
+	// Offset moves the odd field horizontally by this many pixels
+	Offset int
+	// Comb moves the odd field on edges only, by this many pixels at the
+	// strongest edges, like motion between two fields
+	Comb float64
+	// Double replaces the odd field with the even one, doubling every line
+	Double bool
+	// PreviousField takes the even field from the previous gif frame
+	PreviousField bool
+}
+
+// Interlace splits the image into its even and odd rows, the two fields of a
+// broadcast picture, and puts them back together badly.
+func (i *Img) Interlace(o InterlaceOptions) {
+	b := i.Bounds
+	src := cloneImage(i.Out)
+
+	// the even field of the last frame if there is one, else the image itself
+	even := src
+	if o.PreviousField && i.Previous != nil {
+		even = image.NewRGBA(b)
+		draw.Draw(even, b, i.Previous, b.Min, draw.Src)
+	}
+
+	var edges []float64
+	if o.Comb != 0 {
+		edges = edgeStrength(src)
+	}
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		odd := (y-b.Min.Y)%2 == 1
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if !odd {
+				i.Out.Set(x, y, even.RGBAAt(x, y))
+				continue
+			}
+			if o.Double {
+				i.Out.Set(x, y, even.RGBAAt(x, y-1))
+				continue
+			}
+
+			sx := x - o.Offset
+			if edges != nil {
+				e := edges[(y-b.Min.Y)*b.Dx()+(x-b.Min.X)]
+				sx -= int(math.Round(o.Comb * e))
+			}
+			i.Out.Set(x, y, src.RGBAAt(clampX(b, sx), y))
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package soryu
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"testing"
+)
+
+// testFrames returns flat gif frames whose red channel is 50, 100, 150, ...
+func testFrames(n int) []*Img {
+	b := image.Rect(0, 0, 16, 8)
+	var frames []*Img
+	for k := 0; k < n; k++ {
+		src := image.NewRGBA(b)
+		draw.Draw(src, b, image.NewUniform(color.RGBA{uint8(50 * (k + 1)), 0, 0, 0xff}), image.Point{}, draw.Src)
+		frames = append(frames, &Img{In: src, Out: cloneImage(src), Bounds: b, Imgtype: "png", Frame: k})
+	}
+	return frames
+}
+
+// fieldRed returns the red value of the even and the odd field.
+func fieldRed(i *Img) (even, odd uint8) {
+	return i.Out.(*image.RGBA).RGBAAt(3, 0).R, i.Out.(*image.RGBA).RGBAAt(3, 1).R
+}
+
+func TestInterlacePreviousField(t *testing.T) {
+	t.Run("steps", func(t *testing.T) {
+		var last StepHistory
+		for k, i := range testFrames(3) {
+			var next StepHistory
+			for _, s := range ParseSteps("Invert,Interlace") {
+				if err := i.ApplyFrameStep(s, &last, &next, func() {
+					if err := Effects[s.Effect](i, s); err != nil {
+						t.Fatal(err)
+					}
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			last = next
+
+			// the even field is the last frame right before Interlace
+			even, odd := fieldRed(i)
+			wantEven := 255 - 50*uint8(k+1)
+			if k > 0 {
+				wantEven = 255 - 50*uint8(k)
+			}
+			if even != wantEven || odd != 255-50*uint8(k+1) {
+				t.Fatalf("frame %d: fields are %d and %d, want %d and %d", k, even, odd, wantEven, 255-50*uint8(k+1))
+			}
+		}
+	})
+
+	t.Run("graph", func(t *testing.T) {
+		g, err := ReadGraph(strings.NewReader(`{"output": "i", "nodes": [
+			{"id": "src", "type": "source"},
+			{"id": "i", "type": "effect", "effect": "Interlace", "inputs": ["src"]}
+		]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, i := range testFrames(3) {
+			out, err := g.Run(i, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			even, odd := fieldRed(out)
+			wantEven := 50 * uint8(k+1)
+			if k > 0 {
+				wantEven = 50 * uint8(k)
+			}
+			if even != wantEven || odd != 50*uint8(k+1) {
+				t.Fatalf("frame %d: fields are %d and %d, want %d and %d", k, even, odd, wantEven, 50*uint8(k+1))
+			}
+		}
+	})
+}
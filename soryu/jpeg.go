@@ -0,0 +1,490 @@
+package soryu
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"math/rand"
+)
+
+// JPEGCorruptOptions configures JPEGCorrupt.
+type JPEGCorruptOptions struct {
+	// Quality of the jpeg that is corrupted
+	Quality int
+	// Flips is the number of bytes replaced with random values
+	Flips int
+	// Repeats is the number of short spans that are repeated
+	Repeats int
+	// Zeros is the number of runs of zero bytes that are inserted
+	Zeros int
+}
+
+// JPEGCorrupt encodes Out as a jpeg, damages the entropy coded scan data while
+// leaving the headers intact and decodes whatever is left of it.
+func (i *Img) JPEGCorrupt(o JPEGCorruptOptions) error {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, i.Out, &jpeg.Options{Quality: o.Quality}); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+
+	start, end, err := jpegScan(data)
+	if err != nil {
+		return err
+	}
+
+	scan := append([]byte{}, data[start:end]...)
+	scan = corruptScan(scan, o)
+
+	corrupted := append([]byte{}, data[:start]...)
+	corrupted = append(corrupted, scan...)
+	corrupted = append(corrupted, data[end:]...)
+
+	img, err := decodeJPEGTolerant(corrupted)
+	if err != nil {
+		return err
+	}
+	draw.Draw(i.Out, i.Bounds, img, img.Bounds().Min, draw.Src)
+	return nil
+}
+
+// jpegScan returns the start and end of the entropy coded data of the first
+// scan in data.
+func jpegScan(data []byte) (int, int, error) {
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xff {
+			return 0, 0, errors.New("jpeg: missing marker")
+		}
+		marker := data[pos+1]
+		length := int(data[pos+2])<<8 | int(data[pos+3])
+		if marker == 0xda {
+			start := pos + 2 + length
+			end := len(data)
+			if end >= 2 && data[end-2] == 0xff && data[end-1] == 0xd9 {
+				end -= 2
+			}
+			if start > end {
+				return 0, 0, errors.New("jpeg: truncated scan header")
+			}
+			return start, end, nil
+		}
+		pos += 2 + length
+	}
+	return 0, 0, errors.New("jpeg: no scan found")
+}
+
+// corruptScan flips, repeats and inserts bytes in the scan data, then stuffs
+// every 0xff so no new markers appear.
+func corruptScan(scan []byte, o JPEGCorruptOptions) []byte {
+	if len(scan) == 0 {
+		return scan
+	}
+	for n := 0; n < o.Flips; n++ {
+		scan[rand.Intn(len(scan))] = byte(rand.Intn(256))
+	}
+	for n := 0; n < o.Repeats; n++ {
+		p := rand.Intn(len(scan))
+		l := rand.Intn(minInt(64, len(scan)-p)) + 1
+		span := append([]byte{}, scan[p:p+l]...)
+		scan = append(scan[:p+l], append(span, scan[p+l:]...)...)
+	}
+	for n := 0; n < o.Zeros; n++ {
+		p := rand.Intn(len(scan))
+		zeros := make([]byte, rand.Intn(16)+1)
+		scan = append(scan[:p], append(zeros, scan[p:]...)...)
+	}
+
+	stuffed := make([]byte, 0, len(scan))
+	for n := 0; n < len(scan); n++ {
+		stuffed = append(stuffed, scan[n])
+		if scan[n] != 0xff {
+			continue
+		}
+		stuffed = append(stuffed, 0x00)
+		if n+1 < len(scan) && scan[n+1] == 0x00 {
+			n++
+		}
+	}
+	return stuffed
+}
+
+type huffman struct {
+	maxCode [17]int
+	minCode [17]int
+	valPtr  [17]int
+	vals    []byte
+}
+
+func newHuffman(counts []byte, vals []byte) *huffman {
+	h := &huffman{vals: vals}
+	code, k := 0, 0
+	for l := 1; l <= 16; l++ {
+		n := int(counts[l-1])
+		h.valPtr[l] = k
+		h.minCode[l] = code
+		h.maxCode[l] = -1
+		if n > 0 {
+			h.maxCode[l] = code + n - 1
+		}
+		code = (code + n) << 1
+		k += n
+	}
+	return h
+}
+
+// bitReader reads the entropy coded data, removing stuffed bytes. Past the end
+// of the data or at a marker it returns zeros.
+type bitReader struct {
+	data      []byte
+	pos       int
+	acc       uint32
+	n         uint
+	exhausted bool
+}
+
+func (r *bitReader) bit() int {
+	if r.n == 0 {
+		var b byte
+		switch {
+		case r.pos >= len(r.data):
+			r.exhausted = true
+		case r.data[r.pos] != 0xff:
+			b = r.data[r.pos]
+			r.pos++
+		case r.pos+1 < len(r.data) && r.data[r.pos+1] == 0x00:
+			b = 0xff
+			r.pos += 2
+		default:
+			r.exhausted = true
+		}
+		r.acc = uint32(b)
+		r.n = 8
+	}
+	r.n--
+	return int(r.acc>>r.n) & 1
+}
+
+func (r *bitReader) bits(n int) int {
+	v := 0
+	for ; n > 0; n-- {
+		v = v<<1 | r.bit()
+	}
+	return v
+}
+
+// receiveExtend reads an n bit coefficient and extends its sign.
+func (r *bitReader) receiveExtend(n int) int {
+	if n == 0 {
+		return 0
+	}
+	v := r.bits(n)
+	if v < 1<<(n-1) {
+		v += -1<<n + 1
+	}
+	return v
+}
+
+func (r *bitReader) decode(h *huffman) (byte, error) {
+	if h == nil {
+		return 0, errors.New("jpeg: missing huffman table")
+	}
+	code := 0
+	for l := 1; l <= 16; l++ {
+		code = code<<1 | r.bit()
+		if h.maxCode[l] >= 0 && code <= h.maxCode[l] {
+			return h.vals[h.valPtr[l]+code-h.minCode[l]], nil
+		}
+	}
+	return 0, errors.New("jpeg: bad huffman code")
+}
+
+// restart skips to the next restart marker.
+func (r *bitReader) restart() {
+	r.n = 0
+	r.exhausted = false
+	for r.pos+1 < len(r.data) {
+		if r.data[r.pos] == 0xff && r.data[r.pos+1] >= 0xd0 && r.data[r.pos+1] <= 0xd7 {
+			r.pos += 2
+			return
+		}
+		r.pos++
+	}
+}
+
+type jpegComponent struct {
+	id     byte
+	h, v   int
+	tq     byte
+	td, ta byte
+	pred   int
+	stride int
+	plane  []uint8
+}
+
+// decodeJPEGTolerant decodes a baseline jpeg like the ones image/jpeg writes.
+// Unlike image/jpeg it does not give up on damaged scan data: blocks that
+// can't be decoded are left flat and once the data runs out, the remaining
+// blocks are filled with the last known DC value of each component.
+func decodeJPEGTolerant(data []byte) (image.Image, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, errors.New("jpeg: missing SOI marker")
+	}
+
+	var (
+		quant         [4][64]int
+		dc, ac        [4]*huffman
+		comps         []*jpegComponent
+		width, height int
+		restart       int
+	)
+
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xff {
+			return nil, errors.New("jpeg: missing marker")
+		}
+		marker := data[pos+1]
+		if marker == 0xff {
+			pos++
+			continue
+		}
+		length := int(data[pos+2])<<8 | int(data[pos+3])
+		if pos+2+length > len(data) {
+			return nil, errors.New("jpeg: truncated segment")
+		}
+		seg := data[pos+4 : pos+2+length]
+		pos += 2 + length
+
+		switch marker {
+		case 0xdb: // DQT
+			for len(seg) > 0 {
+				precision, id := seg[0]>>4, seg[0]&3
+				seg = seg[1:]
+				for k := 0; k < 64; k++ {
+					if precision == 0 {
+						if len(seg) < 1 {
+							return nil, errors.New("jpeg: short DQT")
+						}
+						quant[id][k] = int(seg[0])
+						seg = seg[1:]
+					} else {
+						if len(seg) < 2 {
+							return nil, errors.New("jpeg: short DQT")
+						}
+						quant[id][k] = int(seg[0])<<8 | int(seg[1])
+						seg = seg[2:]
+					}
+				}
+			}
+		case 0xc0, 0xc1: // SOF0, SOF1
+			if len(seg) < 6 {
+				return nil, errors.New("jpeg: short SOF")
+			}
+			height = int(seg[1])<<8 | int(seg[2])
+			width = int(seg[3])<<8 | int(seg[4])
+			n := int(seg[5])
+			if len(seg) < 6+3*n || (n != 1 && n != 3) {
+				return nil, errors.New("jpeg: unsupported components")
+			}
+			for c := 0; c < n; c++ {
+				s := seg[6+3*c:]
+				comps = append(comps, &jpegComponent{
+					id: s[0],
+					h:  maxInt(1, int(s[1]>>4)),
+					v:  maxInt(1, int(s[1]&15)),
+					tq: s[2] & 3,
+				})
+			}
+		case 0xc2, 0xc3, 0xc5, 0xc6, 0xc7, 0xc9, 0xca, 0xcb, 0xcd, 0xce, 0xcf:
+			return nil, fmt.Errorf("jpeg: unsupported frame type %x", marker)
+		case 0xc4: // DHT
+			for len(seg) >= 17 {
+				class, id := seg[0]>>4, seg[0]&3
+				counts := seg[1:17]
+				total := 0
+				for _, c := range counts {
+					total += int(c)
+				}
+				if len(seg) < 17+total {
+					return nil, errors.New("jpeg: short DHT")
+				}
+				h := newHuffman(counts, seg[17:17+total])
+				if class == 0 {
+					dc[id] = h
+				} else {
+					ac[id] = h
+				}
+				seg = seg[17+total:]
+			}
+		case 0xdd: // DRI
+			if len(seg) >= 2 {
+				restart = int(seg[0])<<8 | int(seg[1])
+			}
+		case 0xda: // SOS
+			if comps == nil {
+				return nil, errors.New("jpeg: scan before frame header")
+			}
+			if len(seg) < 1 || len(seg) < 1+2*int(seg[0]) {
+				return nil, errors.New("jpeg: short SOS")
+			}
+			var scan []*jpegComponent
+			for n := 0; n < int(seg[0]); n++ {
+				for _, c := range comps {
+					if c.id == seg[1+2*n] {
+						c.td, c.ta = seg[2+2*n]>>4&3, seg[2+2*n]&3
+						scan = append(scan, c)
+					}
+				}
+			}
+			r := &bitReader{data: data[pos:]}
+			decodeScan(r, scan, comps, width, height, restart, &quant, &dc, &ac)
+			return jpegImage(comps, width, height), nil
+		}
+	}
+	return nil, errors.New("jpeg: no scan found")
+}
+
+// decodeScan decodes all blocks of a scan into the planes of its components.
+func decodeScan(r *bitReader, scan, comps []*jpegComponent, width, height, restart int, quant *[4][64]int, dc, ac *[4]*huffman) {
+	hmax, vmax := 1, 1
+	for _, c := range comps {
+		hmax, vmax = maxInt(hmax, c.h), maxInt(vmax, c.v)
+	}
+	mcusX := (width + 8*hmax - 1) / (8 * hmax)
+	mcusY := (height + 8*vmax - 1) / (8 * vmax)
+	for _, c := range comps {
+		c.stride = mcusX * c.h * 8
+		c.plane = make([]uint8, c.stride*mcusY*c.v*8)
+	}
+
+	broken := false
+	block := func(c *jpegComponent, bx, by int) {
+		var coef [64]float64
+		q := quant[c.tq]
+		if !broken {
+			// a block that can't be decoded is kept flat and decoding goes on
+			// from wherever the reader ended up, like most decoders do
+			if err := decodeBlock(r, c, &coef, q, dc[c.td], ac[c.ta]); err != nil {
+				coef = [64]float64{}
+				coef[0] = float64(c.pred * q[0])
+			}
+			broken = r.exhausted
+		}
+		if broken {
+			coef = [64]float64{}
+			coef[0] = float64(c.pred * q[0])
+		}
+		idct(&coef)
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 8; x++ {
+				c.plane[(by*8+y)*c.stride+bx*8+x] = uint8(clamp01((coef[y*8+x]+128)/255)*255 + 0.5)
+			}
+		}
+	}
+
+	n := 0
+	if len(scan) == 1 {
+		// non interleaved, one block per MCU and only the blocks covering
+		// the component
+		c := scan[0]
+		bw := ((width*c.h+hmax-1)/hmax + 7) / 8
+		bh := ((height*c.v+vmax-1)/vmax + 7) / 8
+		for by := 0; by < bh; by++ {
+			for bx := 0; bx < bw; bx++ {
+				if restart > 0 && n > 0 && n%restart == 0 && !broken {
+					r.restart()
+					c.pred = 0
+				}
+				block(c, bx, by)
+				n++
+			}
+		}
+		return
+	}
+
+	for my := 0; my < mcusY; my++ {
+		for mx := 0; mx < mcusX; mx++ {
+			if restart > 0 && n > 0 && n%restart == 0 && !broken {
+				r.restart()
+				for _, c := range scan {
+					c.pred = 0
+				}
+			}
+			for _, c := range scan {
+				for v := 0; v < c.v; v++ {
+					for h := 0; h < c.h; h++ {
+						block(c, mx*c.h+h, my*c.v+v)
+					}
+				}
+			}
+			n++
+		}
+	}
+}
+
+// decodeBlock reads the huffman coded coefficients of a single block and
+// dequantizes them into natural order.
+func decodeBlock(r *bitReader, c *jpegComponent, coef *[64]float64, q [64]int, dc, ac *huffman) error {
+	t, err := r.decode(dc)
+	if err != nil {
+		return err
+	}
+	if t > 16 {
+		return errors.New("jpeg: bad DC size")
+	}
+	c.pred += r.receiveExtend(int(t))
+	coef[0] = float64(c.pred * q[0])
+
+	for k := 1; k < 64; k++ {
+		rs, err := r.decode(ac)
+		if err != nil {
+			return err
+		}
+		run, size := int(rs>>4), int(rs&15)
+		if size == 0 {
+			if run != 15 {
+				break
+			}
+			k += 15
+			continue
+		}
+		k += run
+		if k > 63 {
+			return errors.New("jpeg: too many coefficients")
+		}
+		coef[unzig[k]] = float64(r.receiveExtend(size) * q[k])
+	}
+	return nil
+}
+
+// jpegImage converts the decoded planes to an image, upsampling chroma.
+func jpegImage(comps []*jpegComponent, width, height int) image.Image {
+	hmax, vmax := 1, 1
+	for _, c := range comps {
+		hmax, vmax = maxInt(hmax, c.h), maxInt(vmax, c.v)
+	}
+	sample := func(c *jpegComponent, x, y int) uint8 {
+		return c.plane[(y*c.v/vmax)*c.stride+x*c.h/hmax]
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var c color.RGBA
+			if len(comps) == 1 {
+				v := sample(comps[0], x, y)
+				c = color.RGBA{v, v, v, 0xff}
+			} else {
+				r, g, b := color.YCbCrToRGB(sample(comps[0], x, y), sample(comps[1], x, y), sample(comps[2], x, y))
+				c = color.RGBA{r, g, b, 0xff}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
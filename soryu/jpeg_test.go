@@ -0,0 +1,167 @@
+package soryu
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math/rand"
+	"testing"
+)
+
+// testImage is a gradient with some noise, at a size that isn't a multiple of
+// the jpeg block size.
+func testImage(w, h int) *image.RGBA {
+	r := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{
+				uint8(x * 255 / w),
+				uint8(y * 255 / h),
+				uint8(r.Intn(64) + 96),
+				0xff,
+			})
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image, quality int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeJPEGTolerantMatchesImageJPEG(t *testing.T) {
+	tests := []struct {
+		name string
+		img  image.Image
+	}{
+		{"color", testImage(67, 45)},
+		{"gray", func() image.Image {
+			g := image.NewGray(image.Rect(0, 0, 33, 17))
+			for n := range g.Pix {
+				g.Pix[n] = uint8(n * 7)
+			}
+			return g
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := encodeJPEG(t, tt.img, 75)
+			want, err := jpeg.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := decodeJPEGTolerant(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Bounds() != want.Bounds() {
+				t.Fatalf("bounds %v, want %v", got.Bounds(), want.Bounds())
+			}
+
+			// the upsampling and color conversion round a little differently
+			b := want.Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					g := color.NRGBAModel.Convert(got.At(x, y)).(color.NRGBA)
+					w := color.NRGBAModel.Convert(want.At(x, y)).(color.NRGBA)
+					for _, d := range []int{int(g.R) - int(w.R), int(g.G) - int(w.G), int(g.B) - int(w.B)} {
+						if absInt(d) > 3 {
+							t.Fatalf("pixel %d,%d is %v, want %v", x, y, g, w)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeJPEGTolerantCorrupted(t *testing.T) {
+	data := encodeJPEG(t, testImage(67, 45), 75)
+	start, end, err := jpegScan(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		o    JPEGCorruptOptions
+	}{
+		{"flips", JPEGCorruptOptions{Flips: 50}},
+		{"repeats", JPEGCorruptOptions{Repeats: 20}},
+		{"zeros", JPEGCorruptOptions{Zeros: 20}},
+		{"all", JPEGCorruptOptions{Flips: 200, Repeats: 50, Zeros: 50}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for seed := int64(0); seed < 20; seed++ {
+				rand.Seed(seed)
+				scan := corruptScan(append([]byte{}, data[start:end]...), tt.o)
+				corrupted := append(append(append([]byte{}, data[:start]...), scan...), data[end:]...)
+				img, err := decodeJPEGTolerant(corrupted)
+				if err != nil {
+					t.Fatalf("seed %d: %v", seed, err)
+				}
+				if img.Bounds() != image.Rect(0, 0, 67, 45) {
+					t.Fatalf("seed %d: bounds %v", seed, img.Bounds())
+				}
+			}
+		})
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		truncated := append(append([]byte{}, data[:start+(end-start)/3]...), 0xff, 0xd9)
+		if _, err := decodeJPEGTolerant(truncated); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestJPEGCorrupt(t *testing.T) {
+	b := image.Rect(0, 0, 67, 45)
+	corrupt := func(seed int64) *image.RGBA {
+		rand.Seed(seed)
+		i := &Img{In: testImage(67, 45), Out: testImage(67, 45), Bounds: b, Imgtype: "png"}
+		if err := i.JPEGCorrupt(JPEGCorruptOptions{Quality: 50, Flips: 20, Repeats: 5, Zeros: 5}); err != nil {
+			t.Fatal(err)
+		}
+		if i.Out.Bounds() != b {
+			t.Fatalf("bounds %v, want %v", i.Out.Bounds(), b)
+		}
+		return i.Out.(*image.RGBA)
+	}
+
+	first := corrupt(1)
+	if again := corrupt(1); !bytes.Equal(first.Pix, again.Pix) {
+		t.Fatal("same seed gave a different image")
+	}
+	if other := corrupt(2); bytes.Equal(first.Pix, other.Pix) {
+		t.Fatal("different seeds gave the same image")
+	}
+
+	// more than the jpeg compression alone changes
+	data := encodeJPEG(t, testImage(67, 45), 50)
+	clean, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			g := first.RGBAAt(x, y)
+			c := color.RGBAModel.Convert(clean.At(x, y)).(color.RGBA)
+			if absInt(int(g.R)-int(c.R)) > 16 || absInt(int(g.G)-int(c.G)) > 16 || absInt(int(g.B)-int(c.B)) > 16 {
+				changed++
+			}
+		}
+	}
+	if changed < b.Dx()*b.Dy()/20 {
+		t.Fatalf("only %d pixels differ from the clean jpeg", changed)
+	}
+}
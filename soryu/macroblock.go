@@ -0,0 +1,103 @@
+package soryu
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math/rand"
+)
+
+var macroblockOps = []string{"shift", "duplicate", "swap", "freeze"}
+
+// MacroblockOptions configures Macroblock.
+type MacroblockOptions struct {
+	// Size of the blocks in pixels, 0 picks 8, 16 or 32
+	Size int
+	// Ops are the operations to pick from: "shift" moves the content of a
+	// block by up to MaxDisplacement pixels, "duplicate" copies another block
+	// over it, "swap" exchanges it with another block and "freeze" shows the
+	// original image in it. Empty uses all of them.
+	Ops []string
+	// Density is the share of blocks that are glitched (0-1)
+	Density float64
+	// MaxDisplacement is the farthest in pixels a block is taken from
+	MaxDisplacement int
+	// Smear repeats glitched blocks along the rest of their row for a random
+	// length
+	Smear bool
+}
+
+// Macroblock splits the image into square blocks and glitches some of them
+// like a video decoder that lost track of its motion vectors.
+func (i *Img) Macroblock(o MacroblockOptions) error {
+	ops := o.Ops
+	if len(ops) == 0 {
+		ops = macroblockOps
+	}
+	for _, op := range ops {
+		if !contains(macroblockOps, op) {
+			return fmt.Errorf("unknown macroblock operation %q", op)
+		}
+	}
+	size := o.Size
+	if size <= 0 {
+		size = []int{8, 16, 32}[rand.Intn(3)]
+	}
+
+	b := i.Bounds
+	src := cloneImage(i.Out)
+	// frozen blocks show the image as it was loaded
+	in := image.NewRGBA(b)
+	draw.Draw(in, b, i.In, b.Min, draw.Src)
+
+	maxBlocks := o.MaxDisplacement / size
+	// other returns the position of a block at most maxBlocks blocks away
+	other := func(p image.Point) image.Point {
+		q := p.Add(image.Pt(
+			(rand.Intn(2*maxBlocks+1)-maxBlocks)*size,
+			(rand.Intn(2*maxBlocks+1)-maxBlocks)*size,
+		))
+		q.X = b.Min.X + (maxInt(0, minInt(q.X-b.Min.X, b.Dx()-1))/size)*size
+		q.Y = b.Min.Y + (maxInt(0, minInt(q.Y-b.Min.Y, b.Dy()-1))/size)*size
+		return q
+	}
+	block := func(p image.Point) image.Rectangle {
+		return image.Rectangle{p, p.Add(image.Pt(size, size))}.Intersect(b)
+	}
+
+	for y := b.Min.Y; y < b.Max.Y; y += size {
+		for x := b.Min.X; x < b.Max.X; x += size {
+			if rand.Float64() >= o.Density {
+				continue
+			}
+			p := image.Pt(x, y)
+			r := block(p)
+
+			switch ops[rand.Intn(len(ops))] {
+			case "shift":
+				d := image.Pt(
+					rand.Intn(2*o.MaxDisplacement+1)-o.MaxDisplacement,
+					rand.Intn(2*o.MaxDisplacement+1)-o.MaxDisplacement,
+				)
+				draw.Draw(i.Out, r, src, r.Min.Add(d), draw.Src)
+			case "duplicate":
+				draw.Draw(i.Out, r, src, other(p), draw.Src)
+			case "swap":
+				q := other(p)
+				draw.Draw(i.Out, r, src, q, draw.Src)
+				draw.Draw(i.Out, block(q), src, p, draw.Src)
+			case "freeze":
+				draw.Draw(i.Out, r, in, r.Min, draw.Src)
+			}
+
+			if o.Smear {
+				n := rand.Intn((b.Max.X-x)/size + 1)
+				for k := 1; k <= n; k++ {
+					q := block(p.Add(image.Pt(k*size, 0)))
+					draw.Draw(i.Out, q, i.Out, r.Min, draw.Src)
+				}
+			}
+		}
+	}
+	return nil
+}
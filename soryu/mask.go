@@ -0,0 +1,153 @@
+package soryu
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"math/rand"
+	"os"
+
+	"github.com/anthonynsimon/bild/perlin"
+	xdraw "golang.org/x/image/draw"
+)
+
+// LoadMask reads a png or jpeg file and scales it to the given bounds as a
+// grayscale mask.
+func LoadMask(path string, bounds image.Rectangle) (*image.Gray, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+
+	mask := image.NewGray(bounds)
+	xdraw.ApproxBiLinear.Scale(mask, bounds, img, img.Bounds(), draw.Src, nil)
+	return mask, nil
+}
+
+// LinearGradientMask returns a mask going from black to white along the
+// given angle in degrees, 0 runs left to right.
+func LinearGradientMask(bounds image.Rectangle, angle float64) *image.Gray {
+	mask := image.NewGray(bounds)
+	rad := angle * math.Pi / 180
+	dx, dy := math.Cos(rad), math.Sin(rad)
+
+	// project the corners to find the extent of the gradient
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, p := range []image.Point{bounds.Min, {bounds.Max.X, bounds.Min.Y}, {bounds.Min.X, bounds.Max.Y}, bounds.Max} {
+		d := float64(p.X)*dx + float64(p.Y)*dy
+		lo = math.Min(lo, d)
+		hi = math.Max(hi, d)
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			d := float64(x)*dx + float64(y)*dy
+			mask.Pix[mask.PixOffset(x, y)] = gray((d - lo) / (hi - lo))
+		}
+	}
+	return mask
+}
+
+// RadialGradientMask returns a mask that is white at the center (cx, cy) and
+// fades to black at radius. All values are relative to the image size.
+func RadialGradientMask(bounds image.Rectangle, cx, cy, radius float64) *image.Gray {
+	mask := image.NewGray(bounds)
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+	centerX := float64(bounds.Min.X) + cx*w
+	centerY := float64(bounds.Min.Y) + cy*h
+	r := radius * math.Min(w, h)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			d := math.Hypot(float64(x)-centerX, float64(y)-centerY)
+			mask.Pix[mask.PixOffset(x, y)] = gray(1 - d/r)
+		}
+	}
+	return mask
+}
+
+// PerlinMask returns a mask filled with perlin noise, scale is roughly the
+// size of the noise features in pixels.
+func PerlinMask(bounds image.Rectangle, scale float64, octaves int) *image.Gray {
+	p := perlin.NewPerlin(2, 2, octaves, rand.Int63())
+	values := make([]float64, bounds.Dx()*bounds.Dy())
+	lo, hi := math.Inf(1), math.Inf(-1)
+
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			v := p.Noise2D(float64(x)/scale, float64(y)/scale)
+			values[y*bounds.Dx()+x] = v
+			lo = math.Min(lo, v)
+			hi = math.Max(hi, v)
+		}
+	}
+
+	mask := image.NewGray(bounds)
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			v := (values[y*bounds.Dx()+x] - lo) / (hi - lo)
+			mask.Pix[y*mask.Stride+x] = gray(v)
+		}
+	}
+	return mask
+}
+
+// ValueNoiseMask returns a mask of smoothly interpolated random values on a
+// grid with cells of scale pixels.
+func ValueNoiseMask(bounds image.Rectangle, scale float64) *image.Gray {
+	if scale < 1 {
+		scale = 1
+	}
+	gw := int(float64(bounds.Dx())/scale) + 2
+	gh := int(float64(bounds.Dy())/scale) + 2
+	grid := make([]float64, gw*gh)
+	for n := range grid {
+		grid[n] = rand.Float64()
+	}
+
+	mask := image.NewGray(bounds)
+	for y := 0; y < bounds.Dy(); y++ {
+		fy := float64(y) / scale
+		gy := int(fy)
+		ty := smoothstep(fy - float64(gy))
+		for x := 0; x < bounds.Dx(); x++ {
+			fx := float64(x) / scale
+			gx := int(fx)
+			tx := smoothstep(fx - float64(gx))
+
+			top := lerp(grid[gy*gw+gx], grid[gy*gw+gx+1], tx)
+			bottom := lerp(grid[(gy+1)*gw+gx], grid[(gy+1)*gw+gx+1], tx)
+			mask.Pix[y*mask.Stride+x] = gray(lerp(top, bottom, ty))
+		}
+	}
+	return mask
+}
+
+// grayImage returns img as a grayscale mask, converting it if needed.
+func grayImage(img image.Image) *image.Gray {
+	if g, ok := img.(*image.Gray); ok {
+		return g
+	}
+	g := image.NewGray(img.Bounds())
+	draw.Draw(g, g.Rect, img, img.Bounds().Min, draw.Src)
+	return g
+}
+
+// drawMasked draws src over dst, weighted by mask.
+func drawMasked(dst draw.Image, src image.Image, mask *image.Gray) {
+	b := dst.Bounds()
+	draw.DrawMask(dst, b, src, b.Min, alphaMask(mask), b.Min, draw.Over)
+}
+
+// alphaMask converts a grayscale mask into the alpha mask draw.DrawMask expects.
+func alphaMask(mask *image.Gray) *image.Alpha {
+	m := image.NewAlpha(mask.Rect)
+	copy(m.Pix, mask.Pix)
+	return m
+}
@@ -0,0 +1,199 @@
+package soryu
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// PixelSortOptions configures PixelSort.
+type PixelSortOptions struct {
+	// Angle of the sorted lines in degrees, 0 sorts rows and 90 columns
+	Angle float64
+	// Threshold decides which pixels belong to a run: "brightness", "hue",
+	// "saturation" or "edges". Anything else sorts whole lines.
+	Threshold string
+	// Lower and Upper bound the threshold value (0-1) of pixels in a run. For
+	// edges a run ends at pixels with an edge strength above Upper.
+	Lower, Upper float64
+	// SortBy is the sort key: "luminance", "hue", "saturation", "red",
+	// "green" or "blue"
+	SortBy string
+	// Reverse sorts descending
+	Reverse bool
+	// RandomLength cuts runs at random lengths up to this many pixels if > 0
+	RandomLength int
+}
+
+// PixelSort sorts runs of pixels along lines of the image.
+func (i *Img) PixelSort(o PixelSortOptions) {
+	src := cloneImage(i.Out)
+	b := i.Bounds
+
+	var edges []float64
+	if o.Threshold == "edges" {
+		edges = edgeStrength(src)
+	}
+
+	inRun := func(p image.Point, c colorful.Color) bool {
+		var v float64
+		switch o.Threshold {
+		case "brightness":
+			v, _, _ = c.Lab()
+		case "hue":
+			h, _, _ := c.Hsv()
+			v = h / 360
+		case "saturation":
+			_, v, _ = c.Hsv()
+		case "edges":
+			return edges[(p.Y-b.Min.Y)*b.Dx()+(p.X-b.Min.X)] <= o.Upper
+		default:
+			return true
+		}
+		return v >= o.Lower && v <= o.Upper
+	}
+
+	randomLength := func() int {
+		if o.RandomLength > 0 {
+			return rand.Intn(o.RandomLength) + 1
+		}
+		return 0
+	}
+
+	for _, line := range sortLines(b, o.Angle) {
+		start := 0
+		limit := randomLength()
+		for n := 0; n <= len(line); n++ {
+			if n < len(line) {
+				c, _ := colorful.MakeColor(src.At(line[n].X, line[n].Y))
+				if inRun(line[n], c) {
+					if limit == 0 || n-start < limit {
+						continue
+					}
+					// the run is cut, the current pixel starts the next one
+					i.sortRun(src, line[start:n], o)
+					start = n
+					limit = randomLength()
+					continue
+				}
+			}
+			i.sortRun(src, line[start:n], o)
+			start = n + 1
+		}
+	}
+}
+
+// sortRun writes the pixels of src at run, sorted, back to the same positions.
+func (i *Img) sortRun(src *image.RGBA, run []image.Point, o PixelSortOptions) {
+	if len(run) < 2 {
+		return
+	}
+
+	type keyed struct {
+		c   color.RGBA
+		key float64
+	}
+	pixels := make([]keyed, len(run))
+	for n, p := range run {
+		c := src.RGBAAt(p.X, p.Y)
+		pixels[n] = keyed{c, sortKey(c, o.SortBy)}
+	}
+	sort.SliceStable(pixels, func(a, b int) bool {
+		if o.Reverse {
+			return pixels[a].key > pixels[b].key
+		}
+		return pixels[a].key < pixels[b].key
+	})
+	for n, p := range run {
+		i.Out.Set(p.X, p.Y, pixels[n].c)
+	}
+}
+
+func sortKey(c color.RGBA, by string) float64 {
+	switch by {
+	case "red":
+		return float64(c.R)
+	case "green":
+		return float64(c.G)
+	case "blue":
+		return float64(c.B)
+	}
+	cf, _ := colorful.MakeColor(c)
+	switch by {
+	case "hue":
+		h, _, _ := cf.Hsv()
+		return h
+	case "saturation":
+		_, s, _ := cf.Hsv()
+		return s
+	}
+	l, _, _ := cf.Lab()
+	return l
+}
+
+// sortLines splits the bounds into parallel lines at the given angle. Every
+// pixel belongs to exactly one line, ordered along the angle.
+func sortLines(b image.Rectangle, angle float64) [][]image.Point {
+	rad := angle * math.Pi / 180
+	dx, dy := math.Cos(rad), math.Sin(rad)
+
+	minIdx := math.MaxInt32
+	for _, p := range []image.Point{b.Min, {b.Max.X, b.Min.Y}, {b.Min.X, b.Max.Y}, b.Max} {
+		minIdx = minInt(minIdx, int(math.Round(-float64(p.X)*dy+float64(p.Y)*dx)))
+	}
+
+	lines := map[int][]image.Point{}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			idx := int(math.Round(-float64(x)*dy+float64(y)*dx)) - minIdx
+			lines[idx] = append(lines[idx], image.Pt(x, y))
+		}
+	}
+
+	result := make([][]image.Point, 0, len(lines))
+	for _, line := range lines {
+		sort.Slice(line, func(a, c int) bool {
+			pa, pc := line[a], line[c]
+			return float64(pa.X)*dx+float64(pa.Y)*dy < float64(pc.X)*dx+float64(pc.Y)*dy
+		})
+		result = append(result, line)
+	}
+	// map order is random, keep the rng driven run lengths reproducible
+	sort.Slice(result, func(a, c int) bool {
+		return result[a][0].Y*b.Dx()+result[a][0].X < result[c][0].Y*b.Dx()+result[c][0].X
+	})
+	return result
+}
+
+// edgeStrength returns the sobel gradient magnitude of the luminance of img,
+// normalized to 0-1.
+func edgeStrength(img *image.RGBA) []float64 {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	lum := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.RGBAAt(b.Min.X+x, b.Min.Y+y)
+			lum[y*w+x] = (0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)) / 255
+		}
+	}
+	at := func(x, y int) float64 {
+		x = maxInt(0, minInt(x, w-1))
+		y = maxInt(0, minInt(y, h-1))
+		return lum[y*w+x]
+	}
+
+	edges := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+			edges[y*w+x] = math.Min(math.Hypot(gx, gy)/4, 1)
+		}
+	}
+	return edges
+}
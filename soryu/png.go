@@ -0,0 +1,205 @@
+package soryu
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math/rand"
+)
+
+var pngFilters = map[string]int{"none": 0, "sub": 1, "up": 2, "average": 3, "paeth": 4}
+
+// PNGCorruptOptions configures PNGCorrupt.
+type PNGCorruptOptions struct {
+	// Filter used for every row: "none", "sub", "up", "average", "paeth" or
+	// "random" to pick one per row
+	Filter string
+	// FilterFlips is the number of rows whose filter type byte is changed
+	FilterFlips int
+	// DataFlips is the number of filtered bytes replaced with random values
+	DataFlips int
+}
+
+// PNGCorrupt encodes Out as a png with the chosen row filter, then corrupts
+// the filter type bytes and filtered data in the decompressed IDAT stream.
+// Since every row is stored relative to its neighbours, a wrong filter smears
+// the damage across the rest of the image.
+func (i *Img) PNGCorrupt(o PNGCorruptOptions) error {
+	if _, ok := pngFilters[o.Filter]; !ok && o.Filter != "random" {
+		return fmt.Errorf("unknown png filter %q", o.Filter)
+	}
+
+	data, err := encodePNGFiltered(i.Out, o.Filter)
+	if err != nil {
+		return err
+	}
+
+	raw, err := pngIDAT(data)
+	if err != nil {
+		return err
+	}
+
+	b := i.Out.Bounds()
+	stride := 1 + 3*b.Dx()
+	rows := len(raw) / stride
+	if rows > 0 {
+		for n := 0; n < o.FilterFlips; n++ {
+			row := rand.Intn(rows) * stride
+			raw[row] = byte((int(raw[row]) + 1 + rand.Intn(4)) % 5)
+		}
+		for n := 0; n < o.DataFlips; n++ {
+			p := rand.Intn(rows)*stride + 1 + rand.Intn(stride-1)
+			raw[p] = byte(rand.Intn(256))
+		}
+	}
+
+	corrupted, err := writePNG(b.Dx(), b.Dy(), raw)
+	if err != nil {
+		return err
+	}
+	img, err := png.Decode(bytes.NewReader(corrupted))
+	if err != nil {
+		return err
+	}
+
+	// the png has no alpha channel, keep the one of the image
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			_, _, _, a := i.Out.At(x, y).RGBA()
+			r, g, bl, _ := img.At(x-b.Min.X, y-b.Min.Y).RGBA()
+			i.Out.Set(x, y, color.NRGBA64{uint16(r), uint16(g), uint16(bl), uint16(a)})
+		}
+	}
+	return nil
+}
+
+// encodePNGFiltered writes img as an 8 bit RGB png, filtering every row with
+// the given filter, or a random one per row for "random".
+func encodePNGFiltered(img image.Image, filter string) ([]byte, error) {
+	b := img.Bounds()
+	stride := 3 * b.Dx()
+	prev := make([]byte, stride)
+	cur := make([]byte, stride)
+	raw := make([]byte, 0, (stride+1)*b.Dy())
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			p := (x - b.Min.X) * 3
+			cur[p], cur[p+1], cur[p+2] = c.R, c.G, c.B
+		}
+
+		ft, ok := pngFilters[filter]
+		if !ok {
+			ft = rand.Intn(5)
+		}
+		raw = append(raw, byte(ft))
+		for n := 0; n < stride; n++ {
+			var a, up, c byte
+			if n >= 3 {
+				a, c = cur[n-3], prev[n-3]
+			}
+			up = prev[n]
+			var v byte
+			switch ft {
+			case 0:
+				v = cur[n]
+			case 1:
+				v = cur[n] - a
+			case 2:
+				v = cur[n] - up
+			case 3:
+				v = cur[n] - byte((int(a)+int(up))/2)
+			case 4:
+				v = cur[n] - paeth(a, up, c)
+			}
+			raw = append(raw, v)
+		}
+		prev, cur = cur, prev
+	}
+
+	return writePNG(b.Dx(), b.Dy(), raw)
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := absInt(p-int(a)), absInt(p-int(b)), absInt(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+// writePNG writes the filtered rows of an 8 bit RGB image as png.
+func writePNG(width, height int, raw []byte) ([]byte, error) {
+	var idat bytes.Buffer
+	zw := zlib.NewWriter(&idat)
+	if _, err := zw.Write(raw); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.WriteString("\x89PNG\r\n\x1a\n")
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(width))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(height))
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = 2 // RGB
+	writePNGChunk(&out, "IHDR", ihdr)
+	writePNGChunk(&out, "IDAT", idat.Bytes())
+	writePNGChunk(&out, "IEND", nil)
+	return out.Bytes(), nil
+}
+
+func writePNGChunk(w io.Writer, name string, data []byte) {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+	copy(header[4:], name)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	w.Write(header[:])
+	w.Write(data)
+	binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// pngIDAT returns the decompressed contents of all IDAT chunks of a png.
+func pngIDAT(data []byte) ([]byte, error) {
+	if len(data) < 8 {
+		return nil, errors.New("png: short file")
+	}
+	var idat bytes.Buffer
+	pos := 8
+	for pos+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		name := string(data[pos+4 : pos+8])
+		if pos+12+length > len(data) {
+			return nil, errors.New("png: truncated chunk")
+		}
+		if name == "IDAT" {
+			idat.Write(data[pos+8 : pos+8+length])
+		}
+		pos += 12 + length
+	}
+
+	zr, err := zlib.NewReader(&idat)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
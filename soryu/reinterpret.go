@@ -0,0 +1,111 @@
+package soryu
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+)
+
+// ReinterpretOptions configures Reinterpret.
+type ReinterpretOptions struct {
+	// Stride is the number of bytes per row the buffer is read with, 0 uses
+	// the width plus WidthOffset
+	Stride int
+	// WidthOffset is added to the width in pixels if Stride is 0
+	WidthOffset int
+	// Order is the byte order of a pixel, e.g. "rgba", "bgra" or "argb".
+	// With less than 4 bytes per pixel the first letters of the order without
+	// alpha are used.
+	Order string
+	// BytesPerPixel is 1 for gray, 2 for rgb565, 3 or 4
+	BytesPerPixel int
+	// Region limits the effect to part of the image, an empty region is the
+	// whole image
+	Region image.Rectangle
+}
+
+// Reinterpret reads the RGBA bytes of the image as if they were stored with a
+// different row stride, pixel layout or byte order, the glitch of importing
+// raw data with the wrong settings. Rows that don't line up shear diagonally,
+// reads past the end of the buffer wrap around to its start.
+func (i *Img) Reinterpret(o ReinterpretOptions) error {
+	if o.BytesPerPixel < 1 || o.BytesPerPixel > 4 {
+		return fmt.Errorf("bytes per pixel must be between 1 and 4, got %d", o.BytesPerPixel)
+	}
+	order, err := pixelOrder(o.Order, o.BytesPerPixel)
+	if err != nil {
+		return err
+	}
+
+	region := i.Bounds
+	if !o.Region.Empty() {
+		region = o.Region.Intersect(i.Bounds)
+	}
+	if region.Empty() {
+		return nil
+	}
+
+	src := image.NewNRGBA(image.Rect(0, 0, region.Dx(), region.Dy()))
+	draw.Draw(src, src.Bounds(), i.Out, region.Min, draw.Src)
+	buf := src.Pix
+
+	bpp := o.BytesPerPixel
+	stride := o.Stride
+	if stride <= 0 {
+		stride = (region.Dx() + o.WidthOffset) * bpp
+	}
+	if stride <= 0 {
+		return fmt.Errorf("stride must be positive, got %d", stride)
+	}
+
+	var px [4]byte
+	for y := 0; y < region.Dy(); y++ {
+		for x := 0; x < region.Dx(); x++ {
+			offset := y*stride + x*bpp
+			for n := 0; n < bpp; n++ {
+				px[n] = buf[(offset+n)%len(buf)]
+			}
+			i.Out.Set(region.Min.X+x, region.Min.Y+y, decodePixel(px[:bpp], order))
+		}
+	}
+	return nil
+}
+
+// pixelOrder returns, for the bytes of a pixel, which channel of r, g, b, a
+// (0-3) each of them is.
+func pixelOrder(order string, bpp int) ([]int, error) {
+	order = strings.ToLower(order)
+	if len(order) != 4 || strings.Trim(order, "rgba") != "" ||
+		strings.Count(order, "r") != 1 || strings.Count(order, "g") != 1 ||
+		strings.Count(order, "b") != 1 || strings.Count(order, "a") != 1 {
+		return nil, fmt.Errorf("invalid pixel order %q", order)
+	}
+	if bpp < 4 {
+		order = strings.Replace(order, "a", "", 1)
+	}
+
+	var channels []int
+	for _, c := range order {
+		channels = append(channels, strings.IndexRune("rgba", c))
+	}
+	return channels, nil
+}
+
+func decodePixel(px []byte, order []int) color.NRGBA {
+	switch len(px) {
+	case 1:
+		return color.NRGBA{px[0], px[0], px[0], 0xff}
+	case 2:
+		// rgb565, little endian
+		v := uint16(px[0]) | uint16(px[1])<<8
+		px = []byte{uint8(v>>11) << 3, uint8(v>>5) << 2, uint8(v) << 3}
+	}
+
+	c := [4]uint8{3: 0xff}
+	for n, v := range px {
+		c[order[n]] = v
+	}
+	return color.NRGBA{c[0], c[1], c[2], c[3]}
+}
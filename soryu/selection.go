@@ -0,0 +1,110 @@
+package soryu
+
+import (
+	"image"
+	"image/png"
+	"io"
+	"math"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// HueRangeMask selects pixels whose hue lies between from and to (degrees,
+// wrapping around 360 if from > to). feather softens the edges of the range
+// by that many degrees. Unsaturated pixels have no meaningful hue and are
+// faded out of the selection.
+func HueRangeMask(img image.Image, from, to, feather float64) *image.Gray {
+	from, to = math.Mod(from+360, 360), math.Mod(to+360, 360)
+	width := to - from
+	if width < 0 {
+		width += 360
+	}
+	center := math.Mod(from+width/2, 360)
+
+	return selectPixels(img, func(c colorful.Color) float64 {
+		h, s, _ := c.Hsv()
+		d := math.Abs(h - center)
+		if d > 180 {
+			d = 360 - d
+		}
+		v := 1.0
+		if d > width/2 {
+			if feather <= 0 {
+				return 0
+			}
+			v = 1 - (d-width/2)/feather
+		}
+		return clamp01(v) * clamp01(s/0.15)
+	})
+}
+
+// LuminanceMask selects pixels brighter than threshold (0-1), or darker if
+// above is false. softness widens the transition around the threshold.
+func LuminanceMask(img image.Image, threshold float64, above bool, softness float64) *image.Gray {
+	return selectPixels(img, func(c colorful.Color) float64 {
+		l, _, _ := c.Lab()
+		d := l - threshold
+		if !above {
+			d = -d
+		}
+		if softness <= 0 {
+			if d >= 0 {
+				return 1
+			}
+			return 0
+		}
+		return clamp01(0.5 + d/softness)
+	})
+}
+
+// ChromaKeyMask selects pixels close to the given hex color. tolerance is the
+// distance in Lab space (roughly 0-1) that is still fully selected, the
+// selection fades out over another half of that distance.
+func ChromaKeyMask(img image.Image, hex string, tolerance float64) (*image.Gray, error) {
+	k, err := ParseHexColor(hex)
+	if err != nil {
+		return nil, err
+	}
+	key, _ := colorful.MakeColor(k)
+
+	return selectPixels(img, func(c colorful.Color) float64 {
+		d := c.DistanceLab(key)
+		if d <= tolerance {
+			return 1
+		}
+		if tolerance <= 0 {
+			return 0
+		}
+		return clamp01(1 - (d-tolerance)/(tolerance/2))
+	}), nil
+}
+
+// WriteMask writes the mask as a black and white png, useful to preview a
+// selection before glitching with it.
+func WriteMask(out io.Writer, mask *image.Gray) error {
+	return png.Encode(out, mask)
+}
+
+func invertMask(mask *image.Gray) *image.Gray {
+	m := image.NewGray(mask.Rect)
+	for n, v := range mask.Pix {
+		m.Pix[n] = 255 - v
+	}
+	return m
+}
+
+// selectPixels builds a mask by weighting every pixel of img with fn.
+func selectPixels(img image.Image, fn func(colorful.Color) float64) *image.Gray {
+	bounds := img.Bounds()
+	mask := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c, ok := colorful.MakeColor(img.At(x, y))
+			if !ok {
+				continue
+			}
+			mask.Pix[mask.PixOffset(x, y)] = gray(fn(c))
+		}
+	}
+	return mask
+}
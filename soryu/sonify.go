@@ -0,0 +1,186 @@
+package soryu
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+)
+
+var sonifyFilters = []string{"echo", "lowpass", "highpass", "phaser", "distortion", "reverse"}
+
+// SonifyOptions configures Sonify.
+type SonifyOptions struct {
+	// Traversal turns the image into sample streams: "rows" and "columns"
+	// give one stream per line, "buffer" treats the whole image as one
+	// stream in row order
+	Traversal string
+	// Filters are applied in order: "echo", "lowpass", "highpass", "phaser",
+	// "distortion" and "reverse"
+	Filters []string
+	// Delay in samples, Feedback and Mix of the echo
+	Delay    int
+	Feedback float64
+	Mix      float64
+	// Cutoff of the low and high pass as a fraction of the sample rate
+	// (0-0.5) and their resonance
+	Cutoff float64
+	Q      float64
+	// Rate of the phaser sweep in cycles per 1000 samples and its Depth (0-1)
+	Rate  float64
+	Depth float64
+	// Drive of the distortion, 1 is almost clean
+	Drive float64
+}
+
+// Sonify treats the color bytes of the image as 8 bit audio and runs them
+// through audio filters, like opening an image in an audio editor. The red,
+// green and blue bytes of a line are interleaved in one stream, so filters
+// bleed between channels as well as pixels.
+func (i *Img) Sonify(o SonifyOptions) error {
+	for _, f := range o.Filters {
+		if !contains(sonifyFilters, f) {
+			return fmt.Errorf("unknown sonify filter %q", f)
+		}
+	}
+
+	b := i.Bounds
+	buf := image.NewNRGBA(b)
+	draw.Draw(buf, b, i.Out, b.Min, draw.Src)
+
+	var streams [][]int
+	switch o.Traversal {
+	case "rows":
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			streams = append(streams, sampleOffsets(buf, image.Rect(b.Min.X, y, b.Max.X, y+1), false))
+		}
+	case "columns":
+		for x := b.Min.X; x < b.Max.X; x++ {
+			streams = append(streams, sampleOffsets(buf, image.Rect(x, b.Min.Y, x+1, b.Max.Y), true))
+		}
+	case "buffer":
+		streams = append(streams, sampleOffsets(buf, b, false))
+	default:
+		return fmt.Errorf("unknown sonify traversal %q", o.Traversal)
+	}
+
+	for _, offsets := range streams {
+		samples := make([]float64, len(offsets))
+		for n, p := range offsets {
+			samples[n] = (float64(buf.Pix[p]) - 128) / 128
+		}
+		for _, f := range o.Filters {
+			switch f {
+			case "echo":
+				echo(samples, o.Delay, o.Feedback, o.Mix)
+			case "lowpass", "highpass":
+				biquad(samples, f == "highpass", o.Cutoff, o.Q)
+			case "phaser":
+				phaser(samples, o.Rate/1000, o.Depth)
+			case "distortion":
+				distort(samples, o.Drive)
+			case "reverse":
+				for a, c := 0, len(samples)-1; a < c; a, c = a+1, c-1 {
+					samples[a], samples[c] = samples[c], samples[a]
+				}
+			}
+		}
+		for n, p := range offsets {
+			buf.Pix[p] = uint8(math.Round(math.Max(-1, math.Min(samples[n], 127.0/128))*128 + 128))
+		}
+	}
+
+	draw.Draw(i.Out, b, buf, b.Min, draw.Src)
+	return nil
+}
+
+// sampleOffsets returns the offsets of the red, green and blue bytes of the
+// pixels in r, going down the columns first if vertical.
+func sampleOffsets(img *image.NRGBA, r image.Rectangle, vertical bool) []int {
+	offsets := make([]int, 0, r.Dx()*r.Dy()*3)
+	add := func(x, y int) {
+		p := img.PixOffset(x, y)
+		offsets = append(offsets, p, p+1, p+2)
+	}
+	if vertical {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				add(x, y)
+			}
+		}
+		return offsets
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			add(x, y)
+		}
+	}
+	return offsets
+}
+
+// echo mixes a delayed copy of the signal into it, the delayed signal is fed
+// back into the delay line.
+func echo(samples []float64, delay int, feedback, mix float64) {
+	if delay <= 0 {
+		return
+	}
+	line := make([]float64, delay)
+	for n, s := range samples {
+		delayed := line[n%delay]
+		line[n%delay] = s + delayed*feedback
+		samples[n] = s*(1-mix) + delayed*mix
+	}
+}
+
+// biquad runs a low or high pass filter over the signal, with the
+// coefficients of the audio EQ cookbook.
+func biquad(samples []float64, highpass bool, cutoff, q float64) {
+	w := 2 * math.Pi * math.Max(0.0001, math.Min(cutoff, 0.4999))
+	alpha := math.Sin(w) / (2 * math.Max(q, 0.01))
+	cos := math.Cos(w)
+
+	b1 := 1 - cos
+	b0, b2 := b1/2, b1/2
+	if highpass {
+		b1 = -(1 + cos)
+		b0, b2 = -b1/2, -b1/2
+	}
+	a0, a1, a2 := 1+alpha, -2*cos, 1-alpha
+
+	var x1, x2, y1, y2 float64
+	for n, x := range samples {
+		y := (b0*x + b1*x1 + b2*x2 - a1*y1 - a2*y2) / a0
+		x1, x2 = x, x1
+		y1, y2 = y, y1
+		samples[n] = y
+	}
+}
+
+// phaser mixes the signal with a copy of it that went through four first
+// order all pass filters, whose frequency is swept by a sine at rate.
+func phaser(samples []float64, rate, depth float64) {
+	var state [4]float64
+	var last float64
+	for n, x := range samples {
+		// sweep the all pass coefficient between about 0.1 and 0.9
+		lfo := (math.Sin(2*math.Pi*rate*float64(n)) + 1) / 2
+		a := 0.1 + 0.8*lfo*depth
+		y := x + last*0.5
+		for k := range state {
+			out := -a*y + state[k]
+			state[k] = y + a*out
+			y = out
+		}
+		last = y
+		samples[n] = (x + y) / 2
+	}
+}
+
+// distort soft clips the signal.
+func distort(samples []float64, drive float64) {
+	drive = math.Max(drive, 0.01)
+	norm := math.Tanh(drive)
+	for n, x := range samples {
+		samples[n] = math.Tanh(x*drive) / norm
+	}
+}
@@ -35,11 +35,23 @@ const (
 	MAXC = 1<<16 - 1
 )
 
+// boostColors are the names ColorBoost accepted before it took hex colors.
+var boostColors = map[string]string{"red": "#ff0000", "green": "#00ff00", "blue": "#0000ff"}
+
 type Img struct {
 	In      image.Image
 	Out     draw.Image
 	Bounds  image.Rectangle
 	Imgtype string
+	// Frame is the index of the gif frame the image is glitched for, effects
+	// use it to animate their parameters
+	Frame int
+	// Previous is the previous gif frame as it was right before the step that
+	// is applied, nil for the first frame
+	Previous image.Image
+	// PreviousResult is the previous gif frame right after the step that is
+	// applied, for effects that build on their own last result
+	PreviousResult image.Image
 }
 
 type Images struct {
@@ -71,50 +83,19 @@ func (i *Img) Write(out io.Writer) error {
 	return jpeg.Encode(out, i.Out, &opt)
 }
 
+// Streak smears random pixels horizontally for length pixels, to the left if
+// left is set. A negative length streaks to the edge of the image.
 func (i *Img) Streak(streaks, length int, left bool) {
-	bounds := i.Bounds
-	inBounds := i.In.Bounds()
-
-	for streaks > 0 {
-		x := bounds.Min.X + rand.Intn(bounds.Max.X-bounds.Min.X)
-		y := bounds.Min.Y + rand.Intn(bounds.Max.Y-bounds.Min.Y)
-		k := i.Out.At(x, y)
-
-		var streakEnd int
-		if length < 0 {
-			if left {
-				streakEnd = inBounds.Min.X
-			} else {
-				streakEnd = inBounds.Max.X
-			}
-		} else {
-			if left {
-				streakEnd = minInt(x-length, inBounds.Min.X)
-			} else {
-				streakEnd = minInt(x+length, inBounds.Max.X)
-			}
-		}
-
-		for x >= streakEnd {
-			r1, g1, b1, a1 := k.RGBA()
-			r2, g2, b2, a2 := i.Out.At(x, y).RGBA()
-
-			k = color.RGBA{
-				c(r1/4*3 + r2/4),
-				c(g1/4*3 + g2/4),
-				c(b1/4*3 + b2/4),
-				c(a1/4*3 + a2/4),
-			}
-
-			i.Out.Set(x, y, k)
-			if left {
-				x--
-			} else {
-				x++
-			}
-		}
-		streaks--
+	angle := 0.0
+	if left {
+		angle = 180
 	}
+	i.StreakAngle(StreakOptions{
+		Amount: streaks,
+		Angle:  angle,
+		Length: IntRange{length, length},
+		Decay:  0.75,
+	})
 }
 
 func (i *Img) Burst() {
@@ -324,89 +305,78 @@ func (i *Img) GhostStretch() {
 	}
 }
 
-func (i *Img) ColorBoost(boostColor string) {
-	bounds := i.Bounds
+// ColorBoost pushes the image towards boostColor, a hex color or "red",
+// "green" or "blue", by strength (0-1) using the blend mode "tint",
+// "multiply", "screen" or "overlay".
+func (i *Img) ColorBoost(boostColor string, strength float64, mode string) error {
+	if c, ok := boostColors[boostColor]; ok {
+		boostColor = c
+	}
+	boost, err := ParseHexColor(boostColor)
+	if err != nil {
+		return fmt.Errorf("invalid boost color %q: %w", boostColor, err)
+	}
+	cr, cg, cb := float64(boost.R)/255, float64(boost.G)/255, float64(boost.B)/255
+
+	var blendFn func(v, c float64) float64
+	switch mode {
+	case "tint":
+		blendFn = func(v, c float64) float64 { return c }
+	case "multiply":
+		blendFn = func(v, c float64) float64 { return v * c }
+	case "screen":
+		blendFn = func(v, c float64) float64 { return 1 - (1-v)*(1-c) }
+	case "overlay":
+		blendFn = func(v, c float64) float64 {
+			if v < 0.5 {
+				return 2 * v * c
+			}
+			return 1 - 2*(1-v)*(1-c)
+		}
+	default:
+		return fmt.Errorf("unknown color boost blend %q", mode)
+	}
+	channel := func(v uint8, c float64) uint8 {
+		f := float64(v) / 255
+		return gray(lerp(f, blendFn(f, c), strength))
+	}
 
+	bounds := i.Bounds
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 		for x := bounds.Min.X; x < bounds.Max.X; x++ {
-			r, g, b, a := i.Out.At(x, y).RGBA()
-			na := MAXC - (a * r / MAXC)
-			switch boostColor {
-			case "red":
-				r = uint32((r*na + r*a) / MAXC)
-			case "green":
-				g = uint32((g*na + g*a) / MAXC)
-			case "blue":
-				b = uint32((b*na + b*a) / MAXC)
-			}
-			s := color.RGBA64{
-				R: uint16(r),
-				G: uint16(g),
-				B: uint16(b),
-				A: uint16(a),
-			}
-			i.Out.Set(x, y, s)
+			p := color.NRGBAModel.Convert(i.Out.At(x, y)).(color.NRGBA)
+			i.Out.Set(x, y, color.NRGBA{channel(p.R, cr), channel(p.G, cg), channel(p.B, cb), p.A})
 		}
 	}
+	return nil
 }
 
+// Split moves every other band of height rows of the original image width
+// pixels to the left, starting with the second band, or the first if split
+// is set.
 func (i *Img) Split(height, width int, split bool) {
-	bounds := i.Bounds
-	cursor := bounds.Min.Y
-
-	for cursor < bounds.Max.Y {
-		if split {
-			next := cursor + height
-			if next > bounds.Max.Y {
-				return
-			}
-			for cursor < next {
-				for x := bounds.Min.X; x < bounds.Max.X; x++ {
-					tx := x + width
-					if tx >= bounds.Max.X {
-						tx = tx - bounds.Max.X
-					}
-					c := i.In.At(tx, cursor)
-					i.Out.Set(x, cursor, c)
-				}
-				cursor++
-			}
-			cursor = next
-		} else {
-			cursor = cursor + height
-		}
-
-		split = !split
-	}
+	i.BandShift(BandShiftOptions{
+		Width:     IntRange{height, height},
+		Offset:    IntRange{width, width},
+		Alternate: !split,
+		Edge:      "wrap",
+		FromIn:    true,
+	})
 }
 
+// VerticalSplit moves every other band of width columns of the original image
+// height pixels up, starting with the second band, or the first if split is
+// set.
 func (i *Img) VerticalSplit(width, height int, split bool) {
-	bounds := i.Bounds
-	cursor := bounds.Min.X
-
-	for cursor < bounds.Max.X {
-		if split {
-			next := cursor + width
-			if next > bounds.Max.X {
-				return
-			}
-			for cursor < next {
-				for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-					ty := y + height
-					if ty > bounds.Max.Y {
-						ty = ty - bounds.Max.Y
-					}
-					c := i.In.At(cursor, ty)
-					i.Out.Set(cursor, y, c)
-				}
-				cursor++
-			}
-			cursor = next
-		} else {
-			cursor = cursor + width
-		}
-		split = !split
-	}
+	i.BandShift(BandShiftOptions{
+		// at 270 degrees the bands start at the left edge like the columns
+		Angle:     270,
+		Width:     IntRange{width, width},
+		Offset:    IntRange{-height, -height},
+		Alternate: !split,
+		Edge:      "wrap",
+		FromIn:    true,
+	})
 }
 
 func (i *Img) Scanlines() {
@@ -0,0 +1,286 @@
+package soryu
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Step is a single entry of an effect pipeline, e.g. "Streak:mask=radial:invert".
+// Everything after the effect name is a colon separated list of key=value
+// parameters, a key without a value is read as true.
+type Step struct {
+	Effect string
+	Params map[string]string
+
+	// err holds the first parameter that was read but didn't parse, shared by
+	// all copies of the step
+	err *error
+}
+
+// ParseStep parses a single step description.
+func ParseStep(s string) Step {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	step := Step{
+		Effect: parts[0],
+		Params: map[string]string{},
+		err:    new(error),
+	}
+	for _, p := range parts[1:] {
+		if p == "" {
+			continue
+		}
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) == 1 {
+			step.Params[kv[0]] = "true"
+			continue
+		}
+		step.Params[kv[0]] = kv[1]
+	}
+	return step
+}
+
+// ParseSteps parses a comma separated list of steps as given to --order.
+func ParseSteps(order string) []Step {
+	var steps []Step
+	for _, s := range strings.Split(order, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		steps = append(steps, ParseStep(s))
+	}
+	return steps
+}
+
+func (s Step) String(key, def string) string {
+	if v, ok := s.Params[key]; ok {
+		return v
+	}
+	return def
+}
+
+// Int, Float, Bool and IntRange return def if the step doesn't have the key.
+// A value that doesn't parse also returns def and is reported by Err.
+func (s Step) Int(key string, def int) int {
+	v, ok := s.Params[key]
+	if !ok {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		s.invalid(key, "an integer")
+		return def
+	}
+	return n
+}
+
+func (s Step) Float(key string, def float64) float64 {
+	v, ok := s.Params[key]
+	if !ok {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		s.invalid(key, "a number")
+		return def
+	}
+	return f
+}
+
+func (s Step) Bool(key string, def bool) bool {
+	v, ok := s.Params[key]
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		s.invalid(key, "true or false")
+		return def
+	}
+	return b
+}
+
+// Err returns an error for the first parameter that was read but didn't parse.
+func (s Step) Err() error {
+	if s.err == nil {
+		return nil
+	}
+	return *s.err
+}
+
+func (s Step) invalid(key, want string) {
+	if s.err != nil && *s.err == nil {
+		*s.err = fmt.Errorf("%s: invalid %s %q, must be %s", s.Effect, key, s.Params[key], want)
+	}
+}
+
+// IntRange is an inclusive range of integers, written as "4-16" or "-8-8" in
+// a step or as a single number for a fixed value.
+type IntRange struct {
+	Min, Max int
+}
+
+// Rand returns a random value of the range.
+func (r IntRange) Rand() int {
+	if r.Max <= r.Min {
+		return r.Min
+	}
+	return r.Min + rand.Intn(r.Max-r.Min+1)
+}
+
+func (s Step) IntRange(key string, def IntRange) IntRange {
+	v, ok := s.Params[key]
+	if !ok {
+		return def
+	}
+	// the separator is the first dash that isn't a sign, e.g. "-80-80"
+	sep := strings.Index(strings.TrimPrefix(v, "-"), "-")
+	if sep < 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			s.invalid(key, "a number or a range like 4-16")
+			return def
+		}
+		return IntRange{n, n}
+	}
+	sep += len(v) - len(strings.TrimPrefix(v, "-"))
+	min, errMin := strconv.Atoi(v[:sep])
+	max, errMax := strconv.Atoi(v[sep+1:])
+	if errMin != nil || errMax != nil {
+		s.invalid(key, "a number or a range like 4-16")
+		return def
+	}
+	return IntRange{min, max}
+}
+
+// ApplyStep runs effect on the image and composites the result over the image
+// as it was before the step, using the step's blend mode and opacity and
+// weighted by its mask. A parameter of the step that doesn't parse, read by
+// the step or by effect, is returned as error.
+func (i *Img) ApplyStep(s Step, effect func()) error {
+	mask, err := s.Mask(i)
+	if err != nil {
+		return err
+	}
+	return i.applyMasked(s, mask, effect)
+}
+
+// StepHistory holds the image of a gif frame before and after every one of its
+// steps.
+type StepHistory struct {
+	Before, After []image.Image
+}
+
+// ApplyFrameStep is ApplyStep for the next step of a gif frame, the steps are
+// applied in order. The images of the last frame before and after the same
+// step become Previous and PreviousResult, and the images before and after this
+// step are added to next for the frame after.
+func (i *Img) ApplyFrameStep(s Step, last, next *StepHistory, effect func()) error {
+	n := len(next.Before)
+	i.Previous, i.PreviousResult = nil, nil
+	if n < len(last.Before) && n < len(last.After) {
+		i.Previous, i.PreviousResult = last.Before[n], last.After[n]
+	}
+	next.Before = append(next.Before, cloneImage(i.Out))
+	if err := i.ApplyStep(s, effect); err != nil {
+		return err
+	}
+	next.After = append(next.After, cloneImage(i.Out))
+	return nil
+}
+
+// applyMasked is ApplyStep with a mask that was built elsewhere, e.g. by a mask
+// node of a graph.
+func (i *Img) applyMasked(s Step, mask *image.Gray, effect func()) error {
+	mode := s.String("blend", "normal")
+	opacity := s.Float("opacity", 1)
+	if err := s.Err(); err != nil {
+		return err
+	}
+	if _, ok := blendModes[normalizeBlendMode(mode)]; !ok {
+		return fmt.Errorf("unknown blend mode %q", mode)
+	}
+	composite := normalizeBlendMode(mode) != "normal" || opacity < 1
+	if mask == nil && !composite {
+		effect()
+		return s.Err()
+	}
+
+	if mask != nil && s.Bool("invert", false) {
+		mask = invertMask(mask)
+	}
+	if preview := s.String("mask-preview", ""); mask != nil && preview != "" {
+		f, err := os.Create(preview)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := WriteMask(f, mask); err != nil {
+			return err
+		}
+	}
+
+	before := cloneImage(i.Out)
+	effect()
+	if err := s.Err(); err != nil {
+		return err
+	}
+	if composite {
+		result, err := Composite(before, i.Out, mode, opacity)
+		if err != nil {
+			return err
+		}
+		// bild's results start at 0,0, copy them back into the image's bounds
+		draw.Draw(i.Out, i.Bounds, result, result.Bounds().Min, draw.Src)
+	}
+	if mask == nil {
+		return nil
+	}
+
+	after := cloneImage(i.Out)
+	draw.Draw(i.Out, i.Bounds, before, i.Bounds.Min, draw.Src)
+	drawMasked(i.Out, after, mask)
+	return nil
+}
+
+// Mask builds the mask described by the step's mask parameters, or nil if the
+// step has none.
+func (s Step) Mask(i *Img) (*image.Gray, error) {
+	b := i.Bounds
+	switch kind := s.String("mask", ""); kind {
+	case "":
+		return nil, nil
+	case "linear":
+		return LinearGradientMask(b, s.Float("mask-angle", 0)), nil
+	case "radial":
+		return RadialGradientMask(b,
+			s.Float("mask-x", 0.5),
+			s.Float("mask-y", 0.5),
+			s.Float("mask-radius", 0.5),
+		), nil
+	case "perlin":
+		return PerlinMask(b, s.Float("mask-scale", 64), s.Int("mask-octaves", 3)), nil
+	case "noise":
+		return ValueNoiseMask(b, s.Float("mask-scale", 64)), nil
+	case "hue":
+		return HueRangeMask(i.Out,
+			s.Float("hue-from", 330),
+			s.Float("hue-to", 30),
+			s.Float("hue-feather", 10),
+		), nil
+	case "luma":
+		return LuminanceMask(i.Out,
+			s.Float("luma-threshold", 0.7),
+			!s.Bool("luma-below", false),
+			s.Float("luma-softness", 0.1),
+		), nil
+	case "key":
+		return ChromaKeyMask(i.Out, s.String("key-color", "#00ff00"), s.Float("key-tolerance", 0.2))
+	default:
+		return LoadMask(kind, b)
+	}
+}
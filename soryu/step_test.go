@@ -0,0 +1,72 @@
+package soryu
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"testing"
+)
+
+func TestApplyStepKeepsBounds(t *testing.T) {
+	b := image.Rect(10, 20, 73, 61)
+	tests := []string{
+		"Invert:opacity=0.5",
+		"Invert:blend=difference",
+		"Invert:opacity=0.5:mask=linear",
+	}
+	for _, spec := range tests {
+		t.Run(spec, func(t *testing.T) {
+			src := image.NewRGBA(b)
+			draw.Draw(src, b, image.NewUniform(color.RGBA{200, 100, 0, 0xff}), image.Point{}, draw.Src)
+			i := &Img{In: src, Out: cloneImage(src), Bounds: b, Imgtype: "png"}
+			if err := i.Apply(ParseStep(spec)); err != nil {
+				t.Fatal(err)
+			}
+			if i.Out.Bounds() != b {
+				t.Fatalf("bounds %v, want %v", i.Out.Bounds(), b)
+			}
+			// the far corner is changed as well, the layer lines up with the image
+			if c := i.Out.At(b.Max.X-1, b.Max.Y-1); c == (color.RGBA{200, 100, 0, 0xff}) {
+				t.Fatal("corner wasn't composited")
+			}
+			// and no pixel is left transparent
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					if _, _, _, a := i.Out.At(x, y).RGBA(); a != 0xffff {
+						t.Fatalf("pixel %d,%d has alpha %d", x, y, a)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestApplyStepInvalidParams(t *testing.T) {
+	tests := []struct {
+		spec string
+		err  string
+	}{
+		{"Invert:opacity=50%", `invalid opacity "50%"`},
+		{"Posterize:levels=four", `invalid levels "four"`},
+		{"Streak:length=a-b", `invalid length "a-b"`},
+		{"Noise:mask=radial:mask-x=abc", `invalid mask-x "abc"`},
+		{"Invert:mask=linear:invert=maybe", `invalid invert "maybe"`},
+		{"Posterize:levels=8", ""},
+		{"Streak:length=-1", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			i := testImg()
+			err := i.Apply(ParseStep(tt.spec))
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.err != "" && err == nil:
+				t.Fatalf("expected an error containing %q", tt.err)
+			case tt.err != "" && !strings.Contains(err.Error(), tt.err):
+				t.Fatalf("error %q doesn't contain %q", err, tt.err)
+			}
+		})
+	}
+}
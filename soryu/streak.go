@@ -0,0 +1,83 @@
+package soryu
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+
+	"github.com/StephaneBunel/bresenham"
+)
+
+// StreakOptions configures StreakAngle.
+type StreakOptions struct {
+	// Amount of streaks
+	Amount int
+	// Angle of the streaks in degrees, 0 streaks right, 90 down, 180 left
+	// and 270 up. Every streak is turned by up to Jitter degrees either way.
+	Angle  float64
+	Jitter float64
+	// Length of a streak in pixels, negative lengths streak to the edge
+	Length IntRange
+	// Decay is the share of the streak color kept at every pixel, the rest is
+	// taken from the pixel underneath (0-1)
+	Decay float64
+}
+
+// linePoints collects the pixels bresenham plots for a line.
+type linePoints []image.Point
+
+func (l *linePoints) Set(x, y int, _ color.Color) {
+	*l = append(*l, image.Pt(x, y))
+}
+
+// StreakAngle drags the colors of random pixels along lines at an angle,
+// fading into the pixels they pass.
+func (i *Img) StreakAngle(o StreakOptions) {
+	b := i.Bounds
+	if b.Empty() {
+		return
+	}
+	// long enough to cross the whole image from anywhere
+	diagonal := int(math.Ceil(math.Hypot(float64(b.Dx()), float64(b.Dy()))))
+
+	for n := 0; n < o.Amount; n++ {
+		x := b.Min.X + rand.Intn(b.Dx())
+		y := b.Min.Y + rand.Intn(b.Dy())
+		length := o.Length.Rand()
+		if length < 0 {
+			length = diagonal
+		}
+
+		angle := o.Angle
+		if o.Jitter > 0 {
+			angle += (rand.Float64()*2 - 1) * o.Jitter
+		}
+		rad := angle * math.Pi / 180
+		ex := x + int(math.Round(math.Cos(rad)*float64(length)))
+		ey := y + int(math.Round(math.Sin(rad)*float64(length)))
+
+		var line linePoints
+		bresenham.DrawLine(&line, x, y, ex, ey, nil)
+		// bresenham may plot the line from its end
+		if len(line) > 0 && line[0] != image.Pt(x, y) {
+			for a, c := 0, len(line)-1; a < c; a, c = a+1, c-1 {
+				line[a], line[c] = line[c], line[a]
+			}
+		}
+
+		k := i.Out.At(x, y)
+		for _, p := range line {
+			if !p.In(b) {
+				break
+			}
+			r1, g1, b1, a1 := k.RGBA()
+			r2, g2, b2, a2 := i.Out.At(p.X, p.Y).RGBA()
+			mix := func(s, d uint32) uint16 {
+				return uint16(float64(s)*o.Decay + float64(d)*(1-o.Decay))
+			}
+			k = color.RGBA64{mix(r1, r2), mix(g1, g2), mix(b1, b2), mix(a1, a2)}
+			i.Out.Set(p.X, p.Y, k)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package soryu
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math/rand"
+)
+
+// StretchOptions configures Stretch.
+type StretchOptions struct {
+	// Direction the lines are smeared to: "right" and "left" repeat columns,
+	// "down" and "up" repeat rows
+	Direction string
+	// At are the columns or rows to stretch in pixels from the top left. If
+	// it is empty Count random lines are used.
+	At    []int
+	Count int
+	// Length is how many pixels a line is repeated for
+	Length IntRange
+}
+
+// Stretch takes single rows or columns and repeats them over the following
+// pixels in the given direction.
+func (i *Img) Stretch(o StretchOptions) error {
+	b := i.Bounds
+	step, vertical, err := stretchDirection(o.Direction)
+	if err != nil {
+		return err
+	}
+	size := b.Dx()
+	if vertical {
+		size = b.Dy()
+	}
+	if size == 0 {
+		return nil
+	}
+
+	at := o.At
+	if len(at) == 0 {
+		for n := 0; n < o.Count; n++ {
+			at = append(at, rand.Intn(size))
+		}
+	}
+
+	src := cloneImage(i.Out)
+	for _, pos := range at {
+		if pos < 0 || pos >= size {
+			continue
+		}
+		length := o.Length.Rand()
+		for k := 1; k <= length; k++ {
+			dst := pos + k*step
+			if dst < 0 || dst >= size {
+				break
+			}
+			i.copyLine(src, pos, dst, vertical)
+		}
+	}
+	return nil
+}
+
+// SlitScan builds the image from its own result for the previous gif frame
+// moved by speed pixels in the direction, with the lines at slit (in pixels
+// from the top left) taken from the current frame. Every frame pushes the older
+// lines further, so each line of the result is from a different frame. Without
+// a previous frame the image is left alone.
+func (i *Img) SlitScan(direction string, slit, speed int) error {
+	step, vertical, err := stretchDirection(direction)
+	if err != nil {
+		return err
+	}
+	if i.PreviousResult == nil || speed <= 0 {
+		return nil
+	}
+
+	b := i.Bounds
+	size := b.Dx()
+	if vertical {
+		size = b.Dy()
+	}
+	current := cloneImage(i.Out)
+	previous := image.NewRGBA(b)
+	draw.Draw(previous, b, i.PreviousResult, b.Min, draw.Src)
+
+	for pos := 0; pos < size; pos++ {
+		// distance from the slit along the direction
+		d := (pos - slit) * step
+		switch {
+		case d < 0:
+			i.copyLine(current, pos, pos, vertical)
+		case d < speed:
+			i.copyLine(current, slit, pos, vertical)
+		default:
+			i.copyLine(previous, pos-speed*step, pos, vertical)
+		}
+	}
+	return nil
+}
+
+// stretchDirection returns the step along the lines and whether rows are
+// moved instead of columns.
+func stretchDirection(direction string) (int, bool, error) {
+	switch direction {
+	case "right":
+		return 1, false, nil
+	case "left":
+		return -1, false, nil
+	case "down":
+		return 1, true, nil
+	case "up":
+		return -1, true, nil
+	}
+	return 0, false, fmt.Errorf("unknown direction %q", direction)
+}
+
+// copyLine copies column (or row if vertical) from of src to column to of the
+// image, both relative to the bounds.
+func (i *Img) copyLine(src *image.RGBA, from, to int, vertical bool) {
+	b := i.Bounds
+	if vertical {
+		r := image.Rect(b.Min.X, b.Min.Y+to, b.Max.X, b.Min.Y+to+1)
+		draw.Draw(i.Out, r, src, image.Pt(b.Min.X, b.Min.Y+from), draw.Src)
+		return
+	}
+	r := image.Rect(b.Min.X+to, b.Min.Y, b.Min.X+to+1, b.Max.Y)
+	draw.Draw(i.Out, r, src, image.Pt(b.Min.X+from, b.Min.Y), draw.Src)
+}
@@ -0,0 +1,40 @@
+package soryu
+
+import (
+	"image"
+	"testing"
+)
+
+func TestSlitScanFrames(t *testing.T) {
+	const speed = 2
+	var last StepHistory
+	var previous *image.RGBA
+	for k, i := range testFrames(4) {
+		var next StepHistory
+		for _, s := range ParseSteps("Stretch:mode=slitscan:speed=2,Invert") {
+			if err := i.ApplyFrameStep(s, &last, &next, func() {
+				if err := Effects[s.Effect](i, s); err != nil {
+					t.Fatal(err)
+				}
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		last = next
+		out := i.Out.(*image.RGBA)
+
+		b := i.Bounds
+		for x := b.Min.X; x < b.Max.X; x++ {
+			got := out.RGBAAt(x, 0).R
+			want := 255 - 50*uint8(k+1)
+			// older lines keep the look they had, moved along by speed
+			if previous != nil && x >= speed {
+				want = previous.RGBAAt(x-speed, 0).R
+			}
+			if got != want {
+				t.Fatalf("frame %d: column %d is %d, want %d", k, x, got, want)
+			}
+		}
+		previous = out
+	}
+}
@@ -0,0 +1,149 @@
+package soryu
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// swizzleSpaces names the channels of the color spaces Swizzle works in. The
+// fourth channel is always alpha, which can also be called "alpha".
+var swizzleSpaces = map[string][4]string{
+	"rgb":   {"r", "g", "b", "a"},
+	"hsv":   {"h", "s", "v", "a"},
+	"hsl":   {"h", "s", "l", "a"},
+	"ycbcr": {"y", "cb", "cr", "a"},
+	"lab":   {"l", "a", "b", "alpha"},
+}
+
+// swizzleTerm is the source of a channel: another channel, optionally
+// inverted, or a constant.
+type swizzleTerm struct {
+	channel  int
+	invert   bool
+	constant float64
+}
+
+func (t swizzleTerm) value(c [4]float64) float64 {
+	if t.channel < 0 {
+		return t.constant
+	}
+	if t.invert {
+		return 1 - c[t.channel]
+	}
+	return c[t.channel]
+}
+
+// Swizzle remaps the channels of the image, e.g. "r=b,g=r,b=1-g". Every
+// entry assigns a channel from another channel, its inverse or a number
+// (0-1). In space "hsv", "hsl", "ycbcr" or "lab" the channels are those of
+// the color space, all of them scaled to 0-1. Channels that are not assigned
+// keep their value.
+func (i *Img) Swizzle(mapping, space string) error {
+	names, ok := swizzleSpaces[space]
+	if !ok {
+		return fmt.Errorf("unknown color space %q", space)
+	}
+	terms, err := parseSwizzle(mapping, names)
+	if err != nil {
+		return err
+	}
+
+	b := i.Bounds
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := toSpace(color.NRGBAModel.Convert(i.Out.At(x, y)).(color.NRGBA), space)
+			var out [4]float64
+			for n, t := range terms {
+				out[n] = clamp01(t.value(c))
+			}
+			i.Out.Set(x, y, fromSpace(out, space))
+		}
+	}
+	return nil
+}
+
+func parseSwizzle(mapping string, names [4]string) ([4]swizzleTerm, error) {
+	index := func(name string) int {
+		if name == "alpha" {
+			return 3
+		}
+		for n, c := range names {
+			if c == name {
+				return n
+			}
+		}
+		return -1
+	}
+
+	terms := [4]swizzleTerm{{channel: 0}, {channel: 1}, {channel: 2}, {channel: 3}}
+	for _, entry := range strings.Split(mapping, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		dst, src, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		d := index(dst)
+		if !ok || d < 0 {
+			return terms, fmt.Errorf("invalid swizzle %q", entry)
+		}
+
+		if v, err := strconv.ParseFloat(src, 64); err == nil {
+			terms[d] = swizzleTerm{channel: -1, constant: v}
+			continue
+		}
+		t := swizzleTerm{}
+		if strings.HasPrefix(src, "1-") {
+			t.invert = true
+			src = strings.TrimPrefix(src, "1-")
+		}
+		if t.channel = index(src); t.channel < 0 {
+			return terms, fmt.Errorf("invalid swizzle %q", entry)
+		}
+		terms[d] = t
+	}
+	return terms, nil
+}
+
+// toSpace returns the channels of c in the color space, scaled to 0-1.
+func toSpace(c color.NRGBA, space string) [4]float64 {
+	a := float64(c.A) / 255
+	cf := colorful.Color{R: float64(c.R) / 255, G: float64(c.G) / 255, B: float64(c.B) / 255}
+	switch space {
+	case "hsv":
+		h, s, v := cf.Hsv()
+		return [4]float64{h / 360, s, v, a}
+	case "hsl":
+		h, s, l := cf.Hsl()
+		return [4]float64{h / 360, s, l, a}
+	case "ycbcr":
+		y, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+		return [4]float64{float64(y) / 255, float64(cb) / 255, float64(cr) / 255, a}
+	case "lab":
+		// a and b are roughly within -1 and 1
+		l, la, lb := cf.Lab()
+		return [4]float64{l, (la + 1) / 2, (lb + 1) / 2, a}
+	}
+	return [4]float64{cf.R, cf.G, cf.B, a}
+}
+
+func fromSpace(v [4]float64, space string) color.NRGBA {
+	var cf colorful.Color
+	switch space {
+	case "hsv":
+		cf = colorful.Hsv(v[0]*360, v[1], v[2])
+	case "hsl":
+		cf = colorful.Hsl(v[0]*360, v[1], v[2])
+	case "ycbcr":
+		r, g, b := color.YCbCrToRGB(gray(v[0]), gray(v[1]), gray(v[2]))
+		return color.NRGBA{r, g, b, gray(v[3])}
+	case "lab":
+		cf = colorful.Lab(v[0], v[1]*2-1, v[2]*2-1)
+	default:
+		cf = colorful.Color{R: v[0], G: v[1], B: v[2]}
+	}
+	cf = cf.Clamped()
+	return color.NRGBA{gray(cf.R), gray(cf.G), gray(cf.B), gray(v[3])}
+}
@@ -0,0 +1,224 @@
+package soryu
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ToneOptions selects what the tone effects work on.
+type ToneOptions struct {
+	// Space is the color space: "rgb", "hsv", "hsl", "ycbcr" or "lab"
+	Space string
+	// Channels are the names of the channels to change, as for Swizzle.
+	// Empty changes all but alpha.
+	Channels []string
+}
+
+// toneOptions reads the space and channels parameters of a step.
+func toneOptions(s Step) ToneOptions {
+	o := ToneOptions{Space: s.String("space", "rgb")}
+	if v := s.String("channels", ""); v != "" {
+		o.Channels = strings.Split(v, "+")
+	}
+	return o
+}
+
+// BitCrushOptions configures BitCrush.
+type BitCrushOptions struct {
+	// Bits is the number of bits per channel that are kept (1-8)
+	Bits int
+	// Mask is ANDed with every 8 bit value
+	Mask uint8
+	// Shuffle swaps the bits of every value around, the same way for the
+	// whole image
+	Shuffle bool
+}
+
+// CurvePoint is a control point of a tone curve, both values are 0-1.
+type CurvePoint struct {
+	In, Out float64
+}
+
+// Posterize reduces every channel to the given number of levels.
+func (i *Img) Posterize(levels int, o ToneOptions) error {
+	if levels < 2 {
+		return fmt.Errorf("posterize needs at least 2 levels, got %d", levels)
+	}
+	steps := float64(levels - 1)
+	return i.tone(o, func(v float64) float64 {
+		return math.Round(v*steps) / steps
+	})
+}
+
+// Solarize inverts the values above threshold (0-1), like overexposed film.
+func (i *Img) Solarize(threshold float64, o ToneOptions) error {
+	return i.tone(o, func(v float64) float64 {
+		if v > threshold {
+			return 1 - v
+		}
+		return v
+	})
+}
+
+// Invert inverts the channels.
+func (i *Img) Invert(o ToneOptions) error {
+	return i.tone(o, func(v float64) float64 {
+		return 1 - v
+	})
+}
+
+// BitCrush drops the low bits of every channel and optionally masks and
+// shuffles the bits that are left.
+func (i *Img) BitCrush(c BitCrushOptions, o ToneOptions) error {
+	if c.Bits < 1 || c.Bits > 8 {
+		return fmt.Errorf("bit crush keeps 1 to 8 bits, got %d", c.Bits)
+	}
+	keep := uint8(0xff << (8 - c.Bits))
+	order := [8]int{0, 1, 2, 3, 4, 5, 6, 7}
+	if c.Shuffle {
+		rand.Shuffle(len(order), func(a, b int) {
+			order[a], order[b] = order[b], order[a]
+		})
+	}
+
+	return i.tone(o, func(v float64) float64 {
+		b := gray(v) & keep & c.Mask
+		if c.Shuffle {
+			var shuffled uint8
+			for bit, to := range order {
+				shuffled |= (b >> bit & 1) << to
+			}
+			b = shuffled
+		}
+		return float64(b) / 255
+	})
+}
+
+// Curves maps the channels through a smooth curve through the control points.
+// The curve is flat before the first and after the last point.
+func (i *Img) Curves(points []CurvePoint, o ToneOptions) error {
+	if len(points) < 2 {
+		return fmt.Errorf("curves need at least 2 points, got %d", len(points))
+	}
+	curve := monotoneCurve(points)
+
+	// a lookup table is plenty for 8 bit channels
+	var table [256]float64
+	for n := range table {
+		table[n] = curve(float64(n) / 255)
+	}
+	return i.tone(o, func(v float64) float64 {
+		return table[gray(v)]
+	})
+}
+
+// ParseCurve parses control points written as "0/0+0.25/0.15+1/1", in/out
+// pairs joined by "+".
+func ParseCurve(s string) ([]CurvePoint, error) {
+	var points []CurvePoint
+	for _, p := range strings.Split(s, "+") {
+		in, out, ok := strings.Cut(p, "/")
+		x, errIn := strconv.ParseFloat(in, 64)
+		y, errOut := strconv.ParseFloat(out, 64)
+		if !ok || errIn != nil || errOut != nil {
+			return nil, fmt.Errorf("invalid curve point %q", p)
+		}
+		points = append(points, CurvePoint{x, y})
+	}
+	return points, nil
+}
+
+// tone applies fn to the selected channels of every pixel.
+func (i *Img) tone(o ToneOptions, fn func(v float64) float64) error {
+	names, ok := swizzleSpaces[o.Space]
+	if !ok {
+		return fmt.Errorf("unknown color space %q", o.Space)
+	}
+	var selected [4]bool
+	if len(o.Channels) == 0 {
+		selected = [4]bool{true, true, true, false}
+	}
+	for _, name := range o.Channels {
+		n := -1
+		for k, c := range names {
+			if c == name {
+				n = k
+			}
+		}
+		if name == "alpha" {
+			n = 3
+		}
+		if n < 0 {
+			return fmt.Errorf("unknown channel %q in %s", name, o.Space)
+		}
+		selected[n] = true
+	}
+
+	b := i.Bounds
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := toSpace(color.NRGBAModel.Convert(i.Out.At(x, y)).(color.NRGBA), o.Space)
+			for n := range c {
+				if selected[n] {
+					c[n] = clamp01(fn(c[n]))
+				}
+			}
+			i.Out.Set(x, y, fromSpace(c, o.Space))
+		}
+	}
+	return nil
+}
+
+// monotoneCurve returns a monotone cubic interpolation through the points,
+// which doesn't overshoot between them.
+func monotoneCurve(points []CurvePoint) func(float64) float64 {
+	p := append([]CurvePoint(nil), points...)
+	sort.Slice(p, func(a, b int) bool { return p[a].In < p[b].In })
+	n := len(p)
+
+	// slopes of the segments and tangents at the points (Fritsch-Carlson)
+	delta := make([]float64, n-1)
+	for k := 0; k < n-1; k++ {
+		if dx := p[k+1].In - p[k].In; dx > 0 {
+			delta[k] = (p[k+1].Out - p[k].Out) / dx
+		}
+	}
+	m := make([]float64, n)
+	m[0], m[n-1] = delta[0], delta[n-2]
+	for k := 1; k < n-1; k++ {
+		if delta[k-1]*delta[k] > 0 {
+			m[k] = (delta[k-1] + delta[k]) / 2
+		}
+	}
+	for k := 0; k < n-1; k++ {
+		if delta[k] == 0 {
+			m[k], m[k+1] = 0, 0
+			continue
+		}
+		a, b := m[k]/delta[k], m[k+1]/delta[k]
+		if s := a*a + b*b; s > 9 {
+			t := 3 / math.Sqrt(s)
+			m[k], m[k+1] = t*a*delta[k], t*b*delta[k]
+		}
+	}
+
+	return func(x float64) float64 {
+		if x <= p[0].In {
+			return p[0].Out
+		}
+		if x >= p[n-1].In {
+			return p[n-1].Out
+		}
+		k := sort.Search(n, func(k int) bool { return p[k].In > x }) - 1
+		h := p[k+1].In - p[k].In
+		t := (x - p[k].In) / h
+		t2, t3 := t*t, t*t*t
+		return (2*t3-3*t2+1)*p[k].Out + (t3-2*t2+t)*h*m[k] +
+			(-2*t3+3*t2)*p[k+1].Out + (t3-t2)*h*m[k+1]
+	}
+}
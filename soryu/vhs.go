@@ -0,0 +1,176 @@
+package soryu
+
+import (
+	"image/color"
+	"math"
+	"math/rand"
+)
+
+// VHSOptions configures VHS. Every stage has a strength, 0 turns it off.
+type VHSOptions struct {
+	// ChromaBleed is how far in pixels the color smears to the right
+	ChromaBleed float64
+	// Sharpen is the strength of the halos of the luma sharpening
+	Sharpen float64
+	// Tracking is the strength of the tracking error band, TrackingSpeed the
+	// share of the height it rolls up every gif frame
+	Tracking      float64
+	TrackingSpeed float64
+	// HeadSwitch is the strength of the noisy, skewed rows at the bottom
+	HeadSwitch float64
+	// Dropouts is the amount of white dropout streaks
+	Dropouts float64
+	// Wobble is how far in pixels rows wander horizontally
+	Wobble float64
+}
+
+// VHS emulates a worn video tape. The image is converted to YIQ like an NTSC
+// signal, so color and brightness are damaged separately.
+func (i *Img) VHS(o VHSOptions) {
+	b := i.Bounds
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return
+	}
+
+	y, iq, q := make([]float64, w*h), make([]float64, w*h), make([]float64, w*h)
+	alpha := make([]uint8, w*h)
+	for py := 0; py < h; py++ {
+		for px := 0; px < w; px++ {
+			c := color.NRGBAModel.Convert(i.Out.At(b.Min.X+px, b.Min.Y+py)).(color.NRGBA)
+			r, g, bl := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+			n := py*w + px
+			y[n] = 0.299*r + 0.587*g + 0.114*bl
+			iq[n] = 0.596*r - 0.274*g - 0.322*bl
+			q[n] = 0.211*r - 0.523*g + 0.312*bl
+			alpha[n] = c.A
+		}
+	}
+	planes := [][]float64{y, iq, q}
+
+	// the tape wanders slowly, with a little jitter on top
+	if o.Wobble > 0 {
+		phase := rand.Float64() * 2 * math.Pi
+		for row := 0; row < h; row++ {
+			d := o.Wobble * (math.Sin(float64(row)/40+phase) + 0.3*(rand.Float64()*2-1))
+			for _, p := range planes {
+				shiftRow(p[row*w:(row+1)*w], d)
+			}
+		}
+	}
+
+	if o.ChromaBleed > 0 {
+		radius := int(math.Ceil(o.ChromaBleed / 2))
+		for _, p := range planes[1:] {
+			for row := 0; row < h; row++ {
+				line := p[row*w : (row+1)*w]
+				boxBlurRow(line, radius)
+				boxBlurRow(line, radius)
+				shiftRow(line, o.ChromaBleed/2)
+			}
+		}
+	}
+
+	if o.Sharpen > 0 {
+		for row := 0; row < h; row++ {
+			line := y[row*w : (row+1)*w]
+			blurred := append([]float64(nil), line...)
+			boxBlurRow(blurred, 2)
+			for n := range line {
+				line[n] += o.Sharpen * (line[n] - blurred[n])
+			}
+		}
+	}
+
+	if o.Tracking > 0 {
+		// the band starts near the bottom and rolls up with every frame
+		pos := math.Mod(0.8-o.TrackingSpeed*float64(i.Frame), 1)
+		if pos < 0 {
+			pos++
+		}
+		height := maxInt(1, int(o.Tracking*0.08*float64(h)))
+		top := int(pos*float64(h)) - height/2
+		for row := maxInt(0, top); row < minInt(h, top+height); row++ {
+			// strongest in the middle of the band
+			t := 1 - math.Abs(float64(row-top)/float64(height)*2-1)
+			d := o.Tracking * 40 * t * (0.5 + rand.Float64())
+			for _, p := range planes {
+				shiftRow(p[row*w:(row+1)*w], d)
+			}
+			for n := row * w; n < (row+1)*w; n++ {
+				y[n] += o.Tracking * t * (rand.Float64() - 0.3) * 0.5
+				iq[n] *= 1 - t*0.7
+				q[n] *= 1 - t*0.7
+			}
+		}
+	}
+
+	if o.HeadSwitch > 0 {
+		rows := minInt(h, maxInt(1, int(0.02*float64(h))))
+		for k := 0; k < rows; k++ {
+			row := h - 1 - k
+			t := 1 - float64(k)/float64(rows)
+			for _, p := range planes {
+				shiftRow(p[row*w:(row+1)*w], -o.HeadSwitch*30*t)
+			}
+			for n := row * w; n < (row+1)*w; n++ {
+				y[n] += o.HeadSwitch * t * (rand.Float64() - 0.5) * 0.6
+			}
+		}
+	}
+
+	for n := 0; n < int(o.Dropouts*float64(h)/10); n++ {
+		row := rand.Intn(h)
+		length := 5 + rand.Intn(maxInt(1, w/8))
+		start := rand.Intn(w)
+		for px := start; px < minInt(w, start+length); px++ {
+			// fade out towards the end of the streak
+			t := 1 - float64(px-start)/float64(length)
+			k := row*w + px
+			y[k] = lerp(y[k], 1, t)
+			iq[k] *= 1 - t
+			q[k] *= 1 - t
+		}
+	}
+
+	for py := 0; py < h; py++ {
+		for px := 0; px < w; px++ {
+			n := py*w + px
+			r := y[n] + 0.956*iq[n] + 0.621*q[n]
+			g := y[n] - 0.272*iq[n] - 0.647*q[n]
+			bl := y[n] - 1.106*iq[n] + 1.703*q[n]
+			i.Out.Set(b.Min.X+px, b.Min.Y+py, color.NRGBA{gray(r), gray(g), gray(bl), alpha[n]})
+		}
+	}
+}
+
+// shiftRow moves the values of a row by d, which may be fractional. Values
+// shifted in from outside repeat the edge.
+func shiftRow(line []float64, d float64) {
+	src := append([]float64(nil), line...)
+	last := len(line) - 1
+	for n := range line {
+		x := float64(n) - d
+		x0 := math.Floor(x)
+		a := src[maxInt(0, minInt(int(x0), last))]
+		c := src[maxInt(0, minInt(int(x0)+1, last))]
+		line[n] = lerp(a, c, x-x0)
+	}
+}
+
+// boxBlurRow averages every value of a row with radius values on each side.
+func boxBlurRow(line []float64, radius int) {
+	if radius <= 0 {
+		return
+	}
+	src := append([]float64(nil), line...)
+	last := len(line) - 1
+	var sum float64
+	for k := -radius; k <= radius; k++ {
+		sum += src[maxInt(0, minInt(k, last))]
+	}
+	for n := range line {
+		line[n] = sum / float64(2*radius+1)
+		sum += src[minInt(n+radius+1, last)] - src[maxInt(n-radius, 0)]
+	}
+}